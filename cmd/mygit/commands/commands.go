@@ -1,24 +1,32 @@
 package commands
 
 import (
-	"bytes"
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
-	"net/http"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/git"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitdate"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/githttp"
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitpack"
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/readerutils"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/remote"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revision"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revwalk"
 )
 
 func Initialize(createMainBranch bool) (response string, err error) {
-	return "Initialized git directory\n", git.Initialize(true)
+	return "Initialized git directory\n", git.Initialize(defaultBranchName())
 }
 
 func CatFile() (response string, err error) {
@@ -27,7 +35,11 @@ func CatFile() (response string, err error) {
 	}
 	switch argType := os.Args[2]; argType {
 	case "-p":
-		reader, err := gitobject.Reader(os.Args[3])
+		hash, err := revision.Resolve(os.Args[3])
+		if err != nil {
+			return "", err
+		}
+		reader, err := gitobject.Reader(hash)
 		if err != nil {
 			return "", err
 		}
@@ -38,7 +50,7 @@ func CatFile() (response string, err error) {
 		objectType := parts[0]
 		length, _ := strconv.Atoi(parts[1])
 		switch objectType {
-		case "commit":
+		case "commit", "tag":
 			fallthrough
 		case "blob":
 			return string(readerutils.ReadNBytes(length, reader)), nil
@@ -46,11 +58,7 @@ func CatFile() (response string, err error) {
 			treeNodes := gitobject.ReadTree(length, reader)
 			var result strings.Builder
 			for _, node := range treeNodes {
-				objectType := "blob"
-				if node.Mode == 40000 {
-					objectType = "tree"
-				}
-				result.WriteString(fmt.Sprintf("%06d %s %s    %s\n", node.Mode, objectType, node.Hash, node.Name))
+				result.WriteString(fmt.Sprintf("%06d %s %s\t%s\n", node.Mode, node.Type(), node.Hash, node.Name))
 			}
 			return result.String(), nil
 		default:
@@ -73,6 +81,12 @@ func LsTree() (response string, err error) {
 	default:
 		hash = os.Args[2]
 	}
+	if hash, err = revision.Resolve(hash); err != nil {
+		return "", err
+	}
+	if hash, err = revision.PeelTo(hash, "tree"); err != nil {
+		return "", err
+	}
 
 	reader, err := gitobject.Reader(hash)
 	if err != nil {
@@ -93,11 +107,7 @@ func LsTree() (response string, err error) {
 		if nameOnly {
 			result.WriteString(fmt.Sprintf("%s\n", node.Name))
 		} else {
-			objectType := "blob"
-			if node.Mode == 40000 {
-				objectType = "tree"
-			}
-			result.WriteString(fmt.Sprintf("%06d %s %s    %s\n", node.Mode, objectType, node.Hash, node.Name))
+			result.WriteString(fmt.Sprintf("%06d %s %s\t%s\n", node.Mode, node.Type(), node.Hash, node.Name))
 		}
 	}
 	return result.String(), nil
@@ -159,8 +169,12 @@ func WriteTree() (response string, err error) {
 
 func CommitTree() (response string, err error) {
 	commitTreeCmd := flag.NewFlagSet("commit-tree", flag.ExitOnError)
-	treeHash := os.Args[2]
-	parentPtr := commitTreeCmd.String("p", "", "parent commit")
+	treeHash, err := revision.Resolve(os.Args[2])
+	if err != nil {
+		return "", err
+	}
+	var parents stringList
+	commitTreeCmd.Var(&parents, "p", "parent commit")
 	messagePtr := commitTreeCmd.String("m", "", "commit message")
 	commitTreeCmd.Parse(os.Args[3:])
 
@@ -173,33 +187,73 @@ func CommitTree() (response string, err error) {
 	} else if objectType != "tree" {
 		return "", fmt.Errorf("provided hash isn't a tree")
 	}
-	fullTreeHash, _ := gitobject.FullHash(treeHash)
 
-	var commitByteBuffer bytes.Buffer
-	commitByteBuffer.WriteString(fmt.Sprintf("tree %s\n", fullTreeHash))
-	if *parentPtr != "" {
-		if objectType, err := gitobject.Type(*parentPtr); err != nil {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	parentHashes := []string{}
+	for _, parent := range parents {
+		if parent, err = revision.Resolve(parent); err != nil {
+			return "", err
+		}
+		if parent, err = revision.PeelTo(parent, "commit"); err != nil {
 			return "", err
-		} else if objectType != "commit" {
-			return "", fmt.Errorf("provided parent isn't a commit")
 		}
-		fullParentHash, _ := gitobject.FullHash(*parentPtr)
+		parentHashes = append(parentHashes, parent)
+	}
 
-		commitByteBuffer.WriteString(fmt.Sprintf("parent %s\n", fullParentHash))
+	hash, err := writeCommit(cfg, treeHash, parentHashes, *messagePtr+"\n")
+	if err != nil {
+		return "", err
 	}
+	return hash + "\n", nil
+}
 
-	currentTime := fmt.Sprint(time.Now().Unix())
-	timezone, _ := time.Now().Local().Zone()
-	commitByteBuffer.WriteString(fmt.Sprintf("author 123abc <123abc@example.com> %s %s\n", currentTime, timezone))
-	commitByteBuffer.WriteString(fmt.Sprintf("committer 123abc <123abc@example.com> %s %s\n", currentTime, timezone))
-	commitByteBuffer.WriteString("\n")
-	commitByteBuffer.WriteString(fmt.Sprintf("%s\n", *messagePtr))
+// writeCommit writes a commit of tree with the configured identities and
+// returns its hash.
+func writeCommit(cfg *config.Config, tree string, parents []string, message string) (hash string, err error) {
+	commit := &gitobject.Commit{Tree: tree, Parents: parents, Message: message}
+	if commit.Author, err = signature(cfg, "author"); err != nil {
+		return "", err
+	}
+	if commit.Committer, err = signature(cfg, "committer"); err != nil {
+		return "", err
+	}
+	if encoding, ok := cfg.Get("i18n.commitEncoding"); ok && !strings.EqualFold(encoding, "utf-8") {
+		commit.Encoding = encoding
+	}
 
-	hash, err := gitobject.WriteCommit(commitByteBuffer.Bytes())
+	written, err := gitobject.WriteCommit(commit.Bytes())
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%x\n", hash), nil
+	return fmt.Sprintf("%x", written), nil
+}
+
+// signature builds the identity recorded for role, honouring the
+// GIT_<ROLE>_DATE override git uses for reproducible commits.
+func signature(cfg *config.Config, role string) (signature gitobject.Signature, err error) {
+	name, email := cfg.Identity(role)
+	signature = gitobject.Signature{Name: name, Email: email, When: time.Now()}
+	if date, ok := os.LookupEnv(fmt.Sprintf("GIT_%s_DATE", strings.ToUpper(role))); ok {
+		if signature.When, err = gitdate.Parse(date, time.Now()); err != nil {
+			return gitobject.Signature{}, err
+		}
+	}
+	return signature, nil
+}
+
+// stringList collects every value of a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func Clone() (response string, err error) {
@@ -207,87 +261,1095 @@ func Clone() (response string, err error) {
 		return "", fmt.Errorf("usage: mygit clone <remote url> <directory>")
 	}
 
-	remoteUrl := os.Args[2]
-	if remoteUrl[len(remoteUrl)-1] == '/' {
-		remoteUrl = remoteUrl[:len(remoteUrl)-1]
-	}
+	remoteUrl := remote.NormalizeUrl(os.Args[2])
 	directory := os.Args[3]
 
-	client := http.Client{Timeout: time.Duration(30) * time.Second}
-	discoveryRequest, err := http.NewRequest("GET", fmt.Sprintf("%s/info/refs?service=git-upload-pack", remoteUrl), nil)
+	if err := cloneRepository(remoteUrl, directory); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("cloned remote %s to %s\n", remoteUrl, directory), nil
+}
+
+// cloneRepository clones the repository at remoteUrl into directory, which
+// is created unless it exists and is empty, and leaves the process in it
+// with the default branch checked out.
+func cloneRepository(remoteUrl string, directory string) (err error) {
+	client, err := githttp.NewClient(remoteUrl)
+	if err != nil {
+		return err
+	}
+	advertisement, err := remote.Discover(client, remoteUrl)
+	if err != nil {
+		return err
+	}
+
+	if len(advertisement.Refs) == 0 {
+		branch, err := remote.UnbornHead(client, remoteUrl)
+		if err != nil {
+			branch = "refs/heads/" + defaultBranchName()
+		}
+		if err = initializeClone(directory, remoteUrl, strings.TrimPrefix(branch, "refs/heads/")); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "warning: You appear to have cloned an empty repository.")
+		return nil
+	}
+
+	defaultBranch, err := advertisement.DefaultBranch()
+	if err != nil {
+		return err
+	}
+	headHash := defaultBranch.Hash
+	refName := strings.TrimPrefix(defaultBranch.Name, "refs/heads/")
+
+	pack, err := advertisement.FetchPack(client, remoteUrl, advertisedWants(advertisement))
+	if err != nil {
+		return err
+	}
+	defer pack.Close()
+
+	if err = initializeClone(directory, remoteUrl, refName); err != nil {
+		return err
+	}
+	if err = gitpack.Unpack(directory, pack); err != nil {
+		return err
+	}
+	if err = writeRemoteTrackingRefs(advertisement, defaultBranch, "origin", "clone: from "+remoteUrl); err != nil {
+		return err
+	}
+	// HEAD is still unborn, so the whole tree gets written
+	if err = git.CheckoutCommit(headHash); err != nil {
+		return err
+	}
+	if err = git.MakeBranch(refName, headHash, "clone: from "+remoteUrl); err != nil {
+		return err
+	}
+	return nil
+}
+
+// advertisedWants lists the commits the advertised branches and tags point
+// at, once each.
+func advertisedWants(advertisement *remote.Advertisement) (wants []string) {
+	seen := map[string]bool{}
+	for _, ref := range advertisement.Refs {
+		isBranch := strings.HasPrefix(ref.Name, "refs/heads/")
+		isTag := strings.HasPrefix(ref.Name, "refs/tags/") && !strings.HasSuffix(ref.Name, "^{}")
+		if (isBranch || isTag) && !seen[ref.Hash] {
+			seen[ref.Hash] = true
+			wants = append(wants, ref.Hash)
+		}
+	}
+	return wants
+}
+
+// writeRemoteTrackingRefs records the advertised branches under
+// refs/remotes/<remoteName>/, with its HEAD pointing at the default branch, and
+// the advertised tags as they are.
+func writeRemoteTrackingRefs(advertisement *remote.Advertisement, defaultBranch remote.Ref, remoteName string, message string) (err error) {
+	prefix := fmt.Sprintf("refs/remotes/%s/", remoteName)
+	transaction := refs.NewTransaction()
+	for _, ref := range advertisement.Refs {
+		if branch, found := strings.CutPrefix(ref.Name, "refs/heads/"); found {
+			transaction.Update(prefix+branch, ref.Hash, "", message)
+		} else if strings.HasPrefix(ref.Name, "refs/tags/") && !strings.HasSuffix(ref.Name, "^{}") {
+			transaction.Update(ref.Name, ref.Hash, "", message)
+		}
+	}
+	if err = transaction.Commit(); err != nil {
+		return err
+	}
+	return refs.WriteSymbolic(prefix+"HEAD", prefix+strings.TrimPrefix(defaultBranch.Name, "refs/heads/"), message)
+}
+
+// initializeClone creates the repository for a clone with HEAD on branch and
+// origin set up to track the remote.
+func initializeClone(directory string, remoteUrl string, branch string) (err error) {
+	if err = os.Mkdir(directory, 0755); err != nil {
+		// like git, an empty directory can be cloned into
+		entries, readErr := os.ReadDir(directory)
+		if !errors.Is(err, fs.ErrExist) || readErr != nil || len(entries) > 0 {
+			return err
+		}
+	}
+	os.Chdir(directory)
+	if err = git.Initialize(branch); err != nil {
+		return err
+	}
+
+	settings := [][2]string{
+		{"remote.origin.url", remoteUrl},
+		{"remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"},
+		{fmt.Sprintf("branch.%s.remote", branch), "origin"},
+		{fmt.Sprintf("branch.%s.merge", branch), "refs/heads/" + branch},
+	}
+	for _, setting := range settings {
+		if err = config.Set(setting[0], setting[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func defaultBranchName() string {
+	cfg, err := config.Load()
+	if err != nil {
+		return "main"
+	}
+	if branch, ok := cfg.Get("init.defaultBranch"); ok && branch != "" {
+		return branch
+	}
+	return "main"
+}
+
+func LsRemote() (response string, err error) {
+	lsRemoteCmd := flag.NewFlagSet("ls-remote", flag.ExitOnError)
+	heads := lsRemoteCmd.Bool("heads", false, "limit to refs/heads")
+	tags := lsRemoteCmd.Bool("tags", false, "limit to refs/tags")
+	symref := lsRemoteCmd.Bool("symref", false, "show the targets of symbolic refs")
+	lsRemoteCmd.BoolVar(heads, "h", false, "limit to refs/heads")
+	lsRemoteCmd.BoolVar(tags, "t", false, "limit to refs/tags")
+	lsRemoteCmd.Parse(os.Args[2:])
+
+	remoteName := "origin"
+	patterns := []string{}
+	if lsRemoteCmd.NArg() > 0 {
+		remoteName = lsRemoteCmd.Arg(0)
+		patterns = lsRemoteCmd.Args()[1:]
+	}
+	remoteUrl, err := remote.ResolveUrl(remoteName)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := githttp.NewClient(remoteUrl)
+	if err != nil {
+		return "", err
+	}
+	advertisement, err := remote.Discover(client, remoteUrl)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	for _, ref := range advertisement.Refs {
+		if *heads || *tags {
+			if !(*heads && strings.HasPrefix(ref.Name, "refs/heads/")) && !(*tags && strings.HasPrefix(ref.Name, "refs/tags/")) {
+				continue
+			}
+		}
+		if len(patterns) > 0 && !matchesRefTail(patterns, ref.Name) {
+			continue
+		}
+		if *symref {
+			if target, ok := advertisement.Symref(ref.Name); ok {
+				result.WriteString(fmt.Sprintf("ref: %s\t%s\n", target, ref.Name))
+			}
+		}
+		result.WriteString(fmt.Sprintf("%s\t%s\n", ref.Hash, ref.Name))
+	}
+	return result.String(), nil
+}
+
+// matchesRefTail reports whether any pattern matches a trailing run of whole
+// path components of refName, so that "main" matches "refs/heads/main".
+func matchesRefTail(patterns []string, refName string) bool {
+	for _, pattern := range patterns {
+		if wildmatch("*/"+pattern, "/"+refName) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildmatch is a shell style glob where * also matches across slashes.
+func wildmatch(pattern string, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if wildmatch(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		case '[':
+			end := strings.Index(pattern[1:], "]")
+			if end < 0 || len(name) == 0 {
+				return len(name) > 0 && name[0] == '[' && wildmatch(pattern[1:], name[1:])
+			}
+			class := pattern[1 : end+1]
+			negate := len(class) > 0 && (class[0] == '!' || class[0] == '^')
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= name[0] && name[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == name[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+func PackRefs() (response string, err error) {
+	packRefsCmd := flag.NewFlagSet("pack-refs", flag.ExitOnError)
+	all := packRefsCmd.Bool("all", false, "pack all refs, not just tags")
+	noPrune := packRefsCmd.Bool("no-prune", false, "keep the loose refs")
+	packRefsCmd.Parse(os.Args[2:])
+
+	return "", refs.Pack(*all, !*noPrune)
+}
+
+func UpdateRef() (response string, err error) {
+	updateRefCmd := flag.NewFlagSet("update-ref", flag.ExitOnError)
+	deleteRef := updateRefCmd.Bool("d", false, "delete the ref")
+	message := updateRefCmd.String("m", "", "reflog message")
+	stdin := updateRefCmd.Bool("stdin", false, "read a transaction of updates from stdin")
+	updateRefCmd.Parse(os.Args[2:])
+	args := updateRefCmd.Args()
+
+	transaction := refs.NewTransaction()
+	switch {
+	case *stdin:
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			if err := queueRefUpdate(transaction, fields[0], fields[1:], *message); err != nil {
+				return "", err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+	case *deleteRef:
+		if err := queueRefUpdate(transaction, "delete", args, *message); err != nil {
+			return "", err
+		}
+	default:
+		if err := queueRefUpdate(transaction, "update", args, *message); err != nil {
+			return "", err
+		}
+	}
+	return "", transaction.Commit()
+}
+
+func queueRefUpdate(transaction *refs.Transaction, command string, args []string, message string) (err error) {
+	minArgs, maxArgs := map[string]int{"update": 2, "create": 2, "delete": 1, "verify": 1}[command], 0
+	switch command {
+	case "update", "delete", "verify":
+		maxArgs = minArgs + 1
+	case "create":
+		maxArgs = minArgs
+	default:
+		return fmt.Errorf("unknown update-ref command: %s", command)
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		return fmt.Errorf("usage: mygit update-ref [-d] <ref> [<new value>] [<old value>]")
+	}
+
+	values := []string{}
+	for _, value := range args[1:] {
+		if value != refs.ZeroHash {
+			if value, err = gitobject.FullHash(value); err != nil {
+				return err
+			}
+		}
+		values = append(values, value)
+	}
+	values = append(values, "", "")
+
+	switch command {
+	case "update":
+		transaction.Update(args[0], values[0], values[1], message)
+	case "create":
+		transaction.Update(args[0], values[0], refs.ZeroHash, message)
+	case "delete":
+		if values[0] == "" && !refs.Exists(args[0]) {
+			return fmt.Errorf("cannot delete %s: ref does not exist", args[0])
+		}
+		transaction.Delete(args[0], values[0])
+	case "verify":
+		oldHash := values[0]
+		if oldHash == "" {
+			oldHash = refs.ZeroHash
+		}
+		transaction.Verify(args[0], oldHash)
+	}
+	return nil
+}
+
+func Reflog() (response string, err error) {
+	subcommand := "show"
+	args := os.Args[2:]
+	if len(args) > 0 && (args[0] == "show" || args[0] == "expire" || args[0] == "delete") {
+		subcommand = args[0]
+		args = args[1:]
+	}
+
+	switch subcommand {
+	case "expire":
+		return reflogExpire(args)
+	case "delete":
+		return reflogDelete(args)
+	}
+
+	name := "HEAD"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	fullName, err := refs.Dwim(name)
 	if err != nil {
 		return "", err
 	}
-	discoveryResponse, err := client.Do(discoveryRequest)
+	entries, err := refs.ReadReflog(fullName)
 	if err != nil {
 		return "", err
 	}
-	if discoveryResponse.StatusCode != 200 {
-		return "", fmt.Errorf("discovery status: %s", discoveryResponse.Status)
+
+	var result strings.Builder
+	for i := len(entries) - 1; i >= 0; i-- {
+		result.WriteString(fmt.Sprintf("%s %s@{%d}: %s\n", entries[i].NewHash[:7], name, len(entries)-1-i, entries[i].Message))
+	}
+	return result.String(), nil
+}
+
+func reflogExpire(args []string) (response string, err error) {
+	expireCmd := flag.NewFlagSet("reflog expire", flag.ExitOnError)
+	expire := expireCmd.String("expire", "", "prune entries older than this")
+	all := expireCmd.Bool("all", false, "expire the reflogs of all refs")
+	expireCmd.Parse(args)
+
+	if *expire == "" {
+		*expire = "90.days.ago"
+		cfg, err := config.Load()
+		if err != nil {
+			return "", err
+		}
+		if configured, ok := cfg.Get("gc.reflogExpire"); ok {
+			*expire = configured
+		}
+	}
+
+	var cutoff time.Time
+	switch *expire {
+	case "never", "false":
+		return "", nil
+	case "all", "now":
+		cutoff = time.Now().Add(time.Second)
+	default:
+		if cutoff, err = gitdate.Parse(*expire, time.Now()); err != nil {
+			return "", err
+		}
+	}
+
+	names := []string{}
+	if *all {
+		if names, err = refs.ListReflogs(); err != nil {
+			return "", err
+		}
+	}
+	for _, name := range expireCmd.Args() {
+		fullName, err := refs.Dwim(name)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, fullName)
+	}
+
+	for _, name := range names {
+		entries, err := refs.ReadReflog(name)
+		if err != nil {
+			return "", err
+		}
+		kept := []refs.ReflogEntry{}
+		for _, entry := range entries {
+			if !entry.Time.Before(cutoff) {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) != len(entries) {
+			if err := refs.WriteReflog(name, kept); err != nil {
+				return "", err
+			}
+		}
+	}
+	return "", nil
+}
+
+func reflogDelete(args []string) (response string, err error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: mygit reflog delete <ref>@{<n>}...")
+	}
+
+	toDelete := map[string][]int{}
+	for _, arg := range args {
+		at := strings.Index(arg, "@{")
+		if at < 0 || !strings.HasSuffix(arg, "}") {
+			return "", fmt.Errorf("not a reflog entry: %s", arg)
+		}
+		n, err := strconv.Atoi(arg[at+2 : len(arg)-1])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("not a reflog entry: %s", arg)
+		}
+		name := arg[:at]
+		if name == "" {
+			name = "HEAD"
+		}
+		fullName, err := refs.Dwim(name)
+		if err != nil {
+			return "", err
+		}
+		toDelete[fullName] = append(toDelete[fullName], n)
+	}
+
+	for name, indexes := range toDelete {
+		entries, err := refs.ReadReflog(name)
+		if err != nil {
+			return "", err
+		}
+		remove := map[int]bool{}
+		for _, n := range indexes {
+			if n >= len(entries) {
+				return "", fmt.Errorf("reflog entry %s@{%d} not found", name, n)
+			}
+			remove[len(entries)-1-n] = true
+		}
+		kept := []refs.ReflogEntry{}
+		for i, entry := range entries {
+			if !remove[i] {
+				kept = append(kept, entry)
+			}
+		}
+		if err := refs.WriteReflog(name, kept); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func SymbolicRef() (response string, err error) {
+	symbolicRefCmd := flag.NewFlagSet("symbolic-ref", flag.ExitOnError)
+	quiet := symbolicRefCmd.Bool("q", false, "don't complain about detached HEAD")
+	short := symbolicRefCmd.Bool("short", false, "shorten the ref name")
+	deleteRef := symbolicRefCmd.Bool("d", false, "delete the symbolic ref")
+	message := symbolicRefCmd.String("m", "", "reflog message")
+	symbolicRefCmd.Parse(os.Args[2:])
+	args := symbolicRefCmd.Args()
+
+	switch {
+	case *deleteRef && len(args) == 1:
+		return "", refs.DeleteSymbolic(args[0])
+	case len(args) == 1:
+		target, err := refs.ReadSymbolic(args[0])
+		if err != nil {
+			if *quiet {
+				os.Exit(1)
+			}
+			return "", err
+		}
+		if *short {
+			target = shortRefName(target)
+		}
+		return target + "\n", nil
+	case len(args) == 2:
+		return "", refs.WriteSymbolic(args[0], args[1], *message)
 	}
-	defer discoveryResponse.Body.Close()
+	return "", fmt.Errorf("usage: mygit symbolic-ref [-m <reason>] <name> <ref> | [-q] [--short] [-d] <name>")
+}
 
-	// junk lines before ref data
-	data := readerutils.ReadGitPackLine(discoveryResponse.Body)
-	for data != nil {
-		data = readerutils.ReadGitPackLine(discoveryResponse.Body)
+// shortRefName strips the prefixes git leaves off when showing ref names.
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if short, found := strings.CutPrefix(name, prefix); found {
+			return short
+		}
 	}
+	return name
+}
 
-	// first ref has trailing capabilities
-	data = readerutils.ReadGitPackLine(discoveryResponse.Body)
-	refParts := strings.Split(strings.Split(string(data), "\x00")[0], " ")
-	if refParts[1] != "HEAD" {
-		return "", fmt.Errorf("no HEAD ref advertized")
+func RevParse() (response string, err error) {
+	verify, quiet, abbrevRef, symbolicFullName := false, false, false, false
+	shortLength := 0
+	args := []string{}
+	for _, arg := range os.Args[2:] {
+		switch {
+		case arg == "--verify":
+			verify = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--abbrev-ref":
+			abbrevRef = true
+		case arg == "--symbolic-full-name":
+			symbolicFullName = true
+		case arg == "--short":
+			shortLength = 7
+		case strings.HasPrefix(arg, "--short="):
+			if shortLength, err = strconv.Atoi(strings.TrimPrefix(arg, "--short=")); err != nil || shortLength < 4 || shortLength > 40 {
+				return "", fmt.Errorf("fatal: bad --short length '%s'", arg)
+			}
+		case arg == "--git-dir":
+			return ".git\n", nil
+		case arg == "--":
+		default:
+			args = append(args, arg)
+		}
+	}
+	if verify && len(args) != 1 {
+		return "", fmt.Errorf("fatal: Needed a single revision")
 	}
-	headHash := refParts[0]
 
-	headRef := ""
-	for data := readerutils.ReadGitPackLine(discoveryResponse.Body); data != nil; data = readerutils.ReadGitPackLine(discoveryResponse.Body) {
-		refParts := strings.Split(string(data), " ")
-		if refParts[0] != headHash {
+	var result strings.Builder
+	for _, arg := range args {
+		if abbrevRef || symbolicFullName {
+			name, err := revision.SymbolicFullName(arg)
+			if err != nil {
+				return "", err
+			}
+			if abbrevRef && name != "HEAD" {
+				name = shortRefName(name)
+			}
+			if name != "" {
+				result.WriteString(name + "\n")
+			}
 			continue
 		}
-		headRef = refParts[1]
-		if headRef[len(headRef)-1] == '\n' {
-			headRef = headRef[:len(headRef)-1]
+
+		var spec revision.Spec
+		if verify {
+			hash, resolveErr := revision.Resolve(arg)
+			spec, err = revision.Spec{Include: []string{hash}}, resolveErr
+		} else {
+			spec, err = revision.ParseSpec(arg)
+		}
+		if err != nil {
+			if quiet {
+				os.Exit(1)
+			}
+			if verify {
+				return "", fmt.Errorf("fatal: Needed a single revision")
+			}
+			return "", err
 		}
+		for _, hash := range spec.Include {
+			if shortLength > 0 {
+				hash = hash[:shortLength]
+			}
+			result.WriteString(hash + "\n")
+		}
+		for _, hash := range spec.Exclude {
+			if shortLength > 0 {
+				hash = hash[:shortLength]
+			}
+			result.WriteString("^" + hash + "\n")
+		}
+	}
+	return result.String(), nil
+}
+
+func Checkout() (response string, err error) {
+	checkoutCmd := flag.NewFlagSet("checkout", flag.ExitOnError)
+	detach := checkoutCmd.Bool("detach", false, "detach HEAD at the commit")
+	checkoutCmd.Parse(os.Args[2:])
+	if checkoutCmd.NArg() != 1 {
+		return "", fmt.Errorf("usage: mygit checkout [--detach] <branch or commit>")
 	}
-	if headRef == "" {
-		return "", fmt.Errorf("a ref that matches HEAD could not be found")
+	target := checkoutCmd.Arg(0)
+
+	if !*detach && refs.Exists("refs/heads/"+target) {
+		if err := git.Checkout(target); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Switched to branch '%s'\n", target), nil
 	}
-	refName := headRef[strings.LastIndex(headRef, "/")+1:]
 
-	packBody := bytes.NewBuffer([]byte(fmt.Sprintf("0032want %s\n00000009done\n", headHash)))
-	packRequest, err := http.NewRequest("POST", fmt.Sprintf("%s/git-upload-pack?service=git-upload-pack", remoteUrl), packBody)
+	hash, err := revision.Resolve(target)
 	if err != nil {
 		return "", err
 	}
-	packRequest.Header.Add("Content-Type", "application/x-git-upload-pack-request")
-	packResponse, err := client.Do(packRequest)
+	if hash, _, err = gitobject.Peel(hash); err != nil {
+		return "", err
+	}
+	if err := git.CheckoutDetached(hash); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("HEAD is now at %s\n", hash[:7]), nil
+}
+
+func Branch() (response string, err error) {
+	branchCmd := flag.NewFlagSet("branch", flag.ExitOnError)
+	verbose := branchCmd.Bool("v", false, "show the hash and subject of each branch")
+	remotes := branchCmd.Bool("r", false, "act on remote-tracking branches")
+	all := branchCmd.Bool("a", false, "list both local and remote-tracking branches")
+	deleteBranch := branchCmd.Bool("d", false, "delete fully merged branches")
+	forceDelete := branchCmd.Bool("D", false, "delete branches regardless of merge status")
+	move := branchCmd.Bool("m", false, "rename a branch")
+	forceMove := branchCmd.Bool("M", false, "rename a branch even if the new name exists")
+	force := branchCmd.Bool("f", false, "reset the branch if it already exists")
+	upstream := branchCmd.String("set-upstream-to", "", "set the upstream of a branch")
+	branchCmd.StringVar(upstream, "u", "", "set the upstream of a branch")
+	branchCmd.Parse(os.Args[2:])
+	args := branchCmd.Args()
+
+	switch {
+	case *upstream != "":
+		return setUpstream(*upstream, args)
+	case *deleteBranch || *forceDelete:
+		return deleteBranches(args, *remotes, *forceDelete || (*deleteBranch && *force))
+	case *move || *forceMove:
+		return renameBranch(args, *forceMove || (*move && *force))
+	case len(args) > 0:
+		return createBranch(args, *force)
+	}
+	return listBranches(*verbose, *remotes, *all)
+}
+
+func listBranches(verbose bool, remotes bool, all bool) (response string, err error) {
+	type listed struct {
+		display string
+		hash    string
+		target  string
+		current bool
+	}
+	branches := []listed{}
+
+	headTarget, headErr := refs.ReadSymbolic("HEAD")
+	if !remotes || all {
+		if headErr != nil {
+			if hash, err := refs.Read("HEAD"); err == nil {
+				branches = append(branches, listed{fmt.Sprintf("(HEAD detached at %s)", hash[:7]), hash, "", true})
+			}
+		}
+		locals, err := refs.List("refs/heads/")
+		if err != nil {
+			return "", err
+		}
+		for _, ref := range locals {
+			branches = append(branches, listed{strings.TrimPrefix(ref.Name, "refs/heads/"), ref.Hash, "", ref.Name == headTarget})
+		}
+	}
+	if remotes || all {
+		remoteRefs, err := refs.List("refs/remotes/")
+		if err != nil {
+			return "", err
+		}
+		for _, ref := range remoteRefs {
+			display := strings.TrimPrefix(ref.Name, "refs/remotes/")
+			if all {
+				display = "remotes/" + display
+			}
+			target := ""
+			if symbolic, err := refs.ReadSymbolic(ref.Name); err == nil {
+				target = strings.TrimPrefix(symbolic, "refs/remotes/")
+			}
+			branches = append(branches, listed{display, ref.Hash, target, false})
+		}
+	}
+
+	width := 0
+	for _, branch := range branches {
+		if branch.target == "" && len(branch.display) > width {
+			width = len(branch.display)
+		}
+	}
+
+	var result strings.Builder
+	for _, branch := range branches {
+		marker := "  "
+		if branch.current {
+			marker = "* "
+		}
+		switch {
+		case branch.target != "":
+			result.WriteString(fmt.Sprintf("%s%s -> %s\n", marker, branch.display, branch.target))
+		case verbose:
+			commit, err := gitobject.ReadCommit(branch.hash)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(fmt.Sprintf("%s%-*s %s %s\n", marker, width, branch.display, branch.hash[:7], commit.Subject()))
+		default:
+			result.WriteString(fmt.Sprintf("%s%s\n", marker, branch.display))
+		}
+	}
+	return result.String(), nil
+}
+
+func createBranch(args []string, force bool) (response string, err error) {
+	if len(args) > 2 {
+		return "", fmt.Errorf("usage: mygit branch [-f] <branch name> [<start point>]")
+	}
+	name := args[0]
+	startPoint := "HEAD"
+	if len(args) == 2 {
+		startPoint = args[1]
+	}
+
+	fullName := "refs/heads/" + name
+	if err := refs.CheckName(fullName); err != nil {
+		return "", fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	message := "branch: Created from " + startPoint
+	oldHash := refs.ZeroHash
+	if refs.Exists(fullName) {
+		if !force {
+			return "", fmt.Errorf("a branch named '%s' already exists", name)
+		}
+		if current, err := refs.ReadSymbolic("HEAD"); err == nil && current == fullName {
+			return "", fmt.Errorf("cannot force update the current branch")
+		}
+		message = "branch: Reset to " + startPoint
+		oldHash = ""
+	}
+
+	hash, err := revision.Resolve(startPoint)
+	if err != nil {
+		return "", err
+	}
+	hash, objectType, err := gitobject.Peel(hash)
 	if err != nil {
 		return "", err
 	}
-	if packResponse.StatusCode != 200 {
-		return "", fmt.Errorf("pack status: %s", discoveryResponse.Status)
+	if objectType != "commit" {
+		return "", fmt.Errorf("not a valid branch point: '%s'", startPoint)
+	}
+	if err := refs.Update(fullName, hash, oldHash, message); err != nil {
+		return "", err
 	}
-	defer packResponse.Body.Close()
 
-	if err = os.Mkdir(directory, 0755); err != nil {
+	// branching off a remote-tracking branch sets it up as the upstream
+	if startName, err := refs.Dwim(startPoint); err == nil && strings.HasPrefix(startName, "refs/remotes/") {
+		if _, err := refs.ReadSymbolic(startName); err != nil {
+			return setUpstream(startPoint, []string{name})
+		}
+	}
+	return "", nil
+}
+
+func renameBranch(args []string, force bool) (response string, err error) {
+	var oldName, newName string
+	switch len(args) {
+	case 1:
+		current, err := refs.ReadSymbolic("HEAD")
+		if err != nil {
+			return "", fmt.Errorf("cannot rename the current branch while not on any")
+		}
+		oldName, newName = strings.TrimPrefix(current, "refs/heads/"), args[0]
+	case 2:
+		oldName, newName = args[0], args[1]
+	default:
+		return "", fmt.Errorf("usage: mygit branch -m [<old branch>] <new branch>")
+	}
+
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	hash, err := refs.Read(oldRef)
+	if err != nil {
+		return "", fmt.Errorf("no branch named '%s'", oldName)
+	}
+	if err := refs.CheckName(newRef); err != nil {
+		return "", fmt.Errorf("'%s' is not a valid branch name", newName)
+	}
+	newOldHash := refs.ZeroHash
+	if oldRef != newRef && refs.Exists(newRef) {
+		if !force {
+			return "", fmt.Errorf("a branch named '%s' already exists", newName)
+		}
+		newOldHash = ""
+	}
+
+	// the reflog moves first so the rename lands at the end of it
+	if err := refs.RenameReflog(oldRef, newRef); err != nil {
+		return "", err
+	}
+	message := fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef)
+	transaction := refs.NewTransaction()
+	if oldRef != newRef {
+		transaction.Delete(oldRef, hash)
+	}
+	transaction.UpdateNoDeref(newRef, hash, newOldHash, message)
+	if err := transaction.Commit(); err != nil {
+		refs.RenameReflog(newRef, oldRef)
 		return "", err
 	}
-	os.Chdir(directory)
-	git.Initialize(false)
 
-	readerutils.ReadGitPackLine(packResponse.Body) // NAK
-	if err = gitpack.Unpack(directory, packResponse.Body); err != nil {
+	if current, err := refs.ReadSymbolic("HEAD"); err == nil && current == oldRef {
+		if err := refs.WriteSymbolic("HEAD", newRef, message); err != nil {
+			return "", err
+		}
+	}
+	if err := config.RenameSection("branch."+oldName, "branch."+newName); err != nil {
 		return "", err
 	}
-	if err = git.MakeBranch(refName, headHash); err != nil {
+	return "", nil
+}
+
+func deleteBranches(args []string, remotes bool, force bool) (response string, err error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("branch name required")
+	}
+	current, _ := refs.ReadSymbolic("HEAD")
+
+	var result strings.Builder
+	for _, name := range args {
+		fullName := "refs/heads/" + name
+		if remotes {
+			fullName = "refs/remotes/" + name
+		}
+		hash, err := refs.Read(fullName)
+		if err != nil {
+			if remotes {
+				return "", fmt.Errorf("remote-tracking branch '%s' not found", name)
+			}
+			return "", fmt.Errorf("branch '%s' not found", name)
+		}
+		if fullName == current {
+			cwd, _ := os.Getwd()
+			return "", fmt.Errorf("cannot delete branch '%s' checked out at '%s'", name, cwd)
+		}
+
+		if !remotes && !force {
+			mergedInto, err := revision.Upstream(name)
+			if err != nil {
+				mergedInto = "HEAD"
+			}
+			// an upstream that is gone falls back to HEAD, and without a
+			// commit to compare with the branch counts as unmerged
+			into, err := refs.Read(mergedInto)
+			if err != nil && mergedInto != "HEAD" {
+				into, err = refs.Read("HEAD")
+			}
+			merged := false
+			if err == nil {
+				if merged, err = revwalk.IsAncestor(hash, into); err != nil {
+					return "", err
+				}
+			}
+			if !merged {
+				return "", fmt.Errorf("the branch '%s' is not fully merged.\nIf you are sure you want to delete it, run 'mygit branch -D %s'", name, name)
+			}
+		}
+
+		if err := refs.Delete(fullName); err != nil {
+			return "", err
+		}
+		if remotes {
+			result.WriteString(fmt.Sprintf("Deleted remote-tracking branch %s (was %s).\n", name, hash[:7]))
+		} else {
+			if err := config.RemoveSection("branch." + name); err != nil {
+				return "", err
+			}
+			result.WriteString(fmt.Sprintf("Deleted branch %s (was %s).\n", name, hash[:7]))
+		}
+	}
+	return result.String(), nil
+}
+
+func setUpstream(upstream string, args []string) (response string, err error) {
+	var branch string
+	switch len(args) {
+	case 0:
+		current, err := refs.ReadSymbolic("HEAD")
+		if err != nil {
+			return "", fmt.Errorf("could not set upstream of HEAD to %s when it does not point to any branch", upstream)
+		}
+		branch = strings.TrimPrefix(current, "refs/heads/")
+	case 1:
+		branch = args[0]
+	default:
+		return "", fmt.Errorf("too many arguments to set new upstream")
+	}
+	if !refs.Exists("refs/heads/" + branch) {
+		return "", fmt.Errorf("branch '%s' does not exist", branch)
+	}
+
+	upstreamRef, err := refs.Dwim(upstream)
+	if err != nil {
+		return "", fmt.Errorf("the requested upstream branch '%s' does not exist", upstream)
+	}
+	remoteName, merge := ".", upstreamRef
+	if rest, found := strings.CutPrefix(upstreamRef, "refs/remotes/"); found {
+		cfg, err := config.Load()
+		if err != nil {
+			return "", err
+		}
+		remoteName = ""
+		for _, name := range cfg.Subsections("remote") {
+			if branchName, found := strings.CutPrefix(rest, name+"/"); found && len(name) > len(remoteName) {
+				remoteName, merge = name, "refs/heads/"+branchName
+			}
+		}
+		if remoteName == "" {
+			return "", fmt.Errorf("'%s' is not a branch of a configured remote", upstream)
+		}
+	} else if !strings.HasPrefix(upstreamRef, "refs/heads/") {
+		return "", fmt.Errorf("the requested upstream branch '%s' is not a branch", upstream)
+	}
+
+	if err := config.Set(fmt.Sprintf("branch.%s.remote", branch), remoteName); err != nil {
 		return "", err
 	}
-	if err = git.Checkout(refName); err != nil {
+	if err := config.Set(fmt.Sprintf("branch.%s.merge", branch), merge); err != nil {
 		return "", err
 	}
+	return fmt.Sprintf("branch '%s' set up to track '%s'.\n", branch, shortRefName(upstreamRef)), nil
+}
 
-	return fmt.Sprintf("cloned remote %s to %s\n", remoteUrl, directory), nil
+// parseInterspersed parses flags that may come after positional arguments,
+// like git allows, returning the positional arguments in order.
+func parseInterspersed(flags *flag.FlagSet, args []string) (positional []string) {
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func Tag() (response string, err error) {
+	tagCmd := flag.NewFlagSet("tag", flag.ExitOnError)
+	list := tagCmd.Bool("l", false, "list tags matching the patterns")
+	tagCmd.BoolVar(list, "list", false, "list tags matching the patterns")
+	annotate := tagCmd.Bool("a", false, "make an annotated tag")
+	message := tagCmd.String("m", "", "tag message")
+	deleteTags := tagCmd.Bool("d", false, "delete tags")
+	force := tagCmd.Bool("f", false, "replace an existing tag")
+	args := parseInterspersed(tagCmd, os.Args[2:])
+
+	switch {
+	case *deleteTags:
+		return deleteTagRefs(args)
+	case *list || len(args) == 0:
+		return listTags(args)
+	}
+
+	if len(args) > 2 {
+		return "", fmt.Errorf("usage: mygit tag [-a] [-f] [-m <msg>] <tagname> [<object>]")
+	}
+	name := args[0]
+	fullName := "refs/tags/" + name
+	if err := refs.CheckName(fullName); err != nil {
+		return "", fmt.Errorf("'%s' is not a valid tag name", name)
+	}
+	oldHash := refs.ZeroHash
+	if refs.Exists(fullName) {
+		if !*force {
+			return "", fmt.Errorf("tag '%s' already exists", name)
+		}
+		oldHash = ""
+	}
+
+	target := "HEAD"
+	if len(args) == 2 {
+		target = args[1]
+	}
+	hash, err := revision.Resolve(target)
+	if err != nil {
+		return "", err
+	}
+
+	if *annotate || *message != "" {
+		if *message == "" {
+			return "", fmt.Errorf("annotated tags need a message, use -m <msg>")
+		}
+		objectType, err := gitobject.Type(hash)
+		if err != nil {
+			return "", err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return "", err
+		}
+		taggerName, taggerEmail := cfg.Identity("committer")
+		tag := gitobject.Tag{
+			Object:  hash,
+			Type:    objectType,
+			Name:    name,
+			Tagger:  &gitobject.Signature{Name: taggerName, Email: taggerEmail, When: time.Now()},
+			Message: strings.TrimRight(*message, "\n") + "\n",
+		}
+		tagHash, err := gitobject.WriteTag(tag.Bytes())
+		if err != nil {
+			return "", err
+		}
+		hash = fmt.Sprintf("%x", tagHash)
+	}
+
+	if err := refs.Update(fullName, hash, oldHash, ""); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+func listTags(patterns []string) (response string, err error) {
+	tags, err := refs.List("refs/tags/")
+	if err != nil {
+		return "", err
+	}
+	var result strings.Builder
+	for _, tag := range tags {
+		name := strings.TrimPrefix(tag.Name, "refs/tags/")
+		if len(patterns) > 0 {
+			matched := false
+			for _, pattern := range patterns {
+				matched = matched || wildmatch(pattern, name)
+			}
+			if !matched {
+				continue
+			}
+		}
+		result.WriteString(name + "\n")
+	}
+	return result.String(), nil
+}
+
+func deleteTagRefs(names []string) (response string, err error) {
+	var result strings.Builder
+	for _, name := range names {
+		hash, err := refs.Read("refs/tags/" + name)
+		if err != nil {
+			return result.String(), fmt.Errorf("tag '%s' not found", name)
+		}
+		if err := refs.Delete("refs/tags/" + name); err != nil {
+			return "", err
+		}
+		result.WriteString(fmt.Sprintf("Deleted tag '%s' (was %s)\n", name, hash[:7]))
+	}
+	return result.String(), nil
 }
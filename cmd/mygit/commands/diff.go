@@ -0,0 +1,648 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revision"
+)
+
+// diffSnapshot is one side of a diff: a tree, or the files of the index or
+// the working tree keyed by path. A tree's files are only listed when
+// needed, since two trees are compared without reading what they share.
+// Working tree contents aren't in the object store, so they are kept by
+// hash in blobs.
+type diffSnapshot struct {
+	tree  string
+	files map[string]diff.File
+	blobs map[string][]byte
+}
+
+// diffFlags are the options diff and diff-tree share.
+type diffFlags struct {
+	options      diff.Options
+	output       string
+	summary      bool
+	renames      *diff.RenameOptions
+	copiesHarder bool
+	recursive    bool
+}
+
+// parse applies arg if it is one of the shared options.
+func (f *diffFlags) parse(cfg *config.Config, arg string) (handled bool, err error) {
+	name, value, hasValue := strings.Cut(arg, "=")
+	switch {
+	case arg == "-p" || arg == "-u" || arg == "--patch":
+		f.output = "patch"
+	case arg == "--raw" || arg == "--stat" || arg == "--name-only" || arg == "--name-status":
+		f.output = strings.TrimPrefix(arg, "--")
+	case name == "--color":
+		if !hasValue {
+			value = "always"
+		}
+		if f.options.Color, err = colorEnabled(cfg, "diff", value); err != nil {
+			return true, err
+		}
+	case arg == "--no-color":
+		f.options.Color = false
+	case arg == "-w" || arg == "--ignore-all-space":
+		f.options.IgnoreAllSpace = true
+	case arg == "-b" || arg == "--ignore-space-change":
+		f.options.IgnoreSpaceChange = true
+	case arg == "--histogram":
+		f.options.Algorithm = diff.Histogram
+	case name == "--diff-algorithm":
+		if f.options.Algorithm, err = diff.ParseAlgorithm(value); err != nil {
+			return true, fmt.Errorf("fatal: %s", err)
+		}
+	case name == "--unified" || strings.HasPrefix(arg, "-U"):
+		context := strings.TrimPrefix(strings.TrimPrefix(arg, "--unified="), "-U")
+		if f.options.Context, err = strconv.Atoi(context); err != nil || f.options.Context < 0 {
+			return true, fmt.Errorf("fatal: '%s': not a non-negative integer", context)
+		}
+	case arg == "--no-renames":
+		f.renames = nil
+	case strings.HasPrefix(arg, "-M"):
+		f.findRenames(strings.TrimPrefix(arg, "-M"), false)
+	case name == "--find-renames":
+		f.findRenames(value, false)
+	case strings.HasPrefix(arg, "-C"):
+		f.findRenames(strings.TrimPrefix(arg, "-C"), true)
+	case name == "--find-copies":
+		f.findRenames(value, true)
+	case arg == "--find-copies-harder":
+		f.findRenames("", true)
+		f.copiesHarder = true
+	case arg == "-r":
+		f.recursive = true
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// findRenames turns on rename detection, or copy detection as well, with
+// the threshold in score if there is one.
+func (f *diffFlags) findRenames(score string, copies bool) {
+	if f.renames == nil {
+		renames := diff.DefaultRenameOptions()
+		f.renames = &renames
+	}
+	if score != "" {
+		f.renames.MinimumScore = diff.ParseScore(score)
+	}
+	f.renames.Copies = f.renames.Copies || copies
+}
+
+// configuredRenames reads diff.renames, which is on by default and may ask
+// for copies too.
+func configuredRenames(cfg *config.Config) (renames *diff.RenameOptions, err error) {
+	value, ok := cfg.Get("diff.renames")
+	if !ok {
+		value = "true"
+	}
+	options := diff.DefaultRenameOptions()
+	if value == "copies" || value == "copy" {
+		options.Copies = true
+		return &options, nil
+	}
+	enabled, err := config.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("fatal: bad config variable 'diff.renames': %s", value)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return &options, nil
+}
+
+func Diff() (response string, err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	flags := diffFlags{options: diff.DefaultOptions(), output: "patch"}
+	if flags.options.Color, err = colorEnabled(cfg, "diff", ""); err != nil {
+		return "", err
+	}
+	if flags.renames, err = configuredRenames(cfg); err != nil {
+		return "", err
+	}
+	cached := false
+	revisions := []string{}
+	paths := []string{}
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		handled, err := flags.parse(cfg, arg)
+		switch {
+		case err != nil:
+			return "", err
+		case handled:
+		case arg == "--":
+			paths = append(paths, args[i+1:]...)
+			i = len(args)
+		case arg == "--cached" || arg == "--staged":
+			cached = true
+		case strings.HasPrefix(arg, "-"):
+			return "", fmt.Errorf("fatal: unrecognized argument: %s", arg)
+		default:
+			revisions = append(revisions, arg)
+		}
+	}
+
+	oldSide, newSide, unmerged, err := diffSides(revisions, cached, &paths)
+	if err != nil {
+		return "", err
+	}
+	changes, err := compareSnapshots(oldSide, newSide, diff.TreeOptions{Recursive: true, Paths: paths}, flags)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range unmerged {
+		if diff.MatchesPathspec(path, paths) {
+			changes = append(changes, diff.FileChange{Status: diff.Unmerged, New: diff.File{Path: path}})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path() < changes[j].Path() })
+	return formatChanges(changes, oldSide, newSide, flags)
+}
+
+// DiffTree compares two trees, or a commit with its parent, and by default
+// lists the changed entries in git's raw format. Without -r, changed
+// subtrees are listed instead of what changed inside them.
+func DiffTree() (response string, err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	flags := diffFlags{options: diff.DefaultOptions(), output: "raw"}
+	treeOptions := diff.TreeOptions{}
+	showRoot, showCommitID := false, true
+	treeishes := []string{}
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		handled, err := flags.parse(cfg, arg)
+		switch {
+		case err != nil:
+			return "", err
+		case handled:
+		case arg == "--":
+			treeOptions.Paths = append(treeOptions.Paths, args[i+1:]...)
+			i = len(args)
+		case arg == "-t":
+			treeOptions.ShowTrees = true
+		case arg == "--root":
+			showRoot = true
+		case arg == "--no-commit-id":
+			showCommitID = false
+		case strings.HasPrefix(arg, "-"):
+			return "", fmt.Errorf("fatal: unrecognized argument: %s", arg)
+		case len(treeishes) < 2 && len(treeOptions.Paths) == 0:
+			treeishes = append(treeishes, arg)
+		default:
+			treeOptions.Paths = append(treeOptions.Paths, arg)
+		}
+	}
+	// only the listings walk trees one level at a time
+	treeOptions.Recursive = flags.recursive || treeOptions.ShowTrees ||
+		(flags.output != "raw" && flags.output != "name-only" && flags.output != "name-status")
+
+	header := ""
+	var oldTree, newTree string
+	switch len(treeishes) {
+	case 1:
+		commitHash, err := revision.Resolve(treeishes[0])
+		if err != nil {
+			return "", err
+		}
+		if commitHash, err = revision.PeelTo(commitHash, "commit"); err != nil {
+			return "", err
+		}
+		commit, err := gitobject.ReadCommit(commitHash)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case len(commit.Parents) == 1:
+			parent, err := gitobject.ReadCommit(commit.Parents[0])
+			if err != nil {
+				return "", err
+			}
+			oldTree = parent.Tree
+		case len(commit.Parents) > 1 || !showRoot:
+			// like git, merges and root commits show nothing by default
+			return "", nil
+		}
+		newTree = commit.Tree
+		if showCommitID {
+			header = commitHash + "\n"
+		}
+	case 2:
+		for i, treeish := range treeishes {
+			hash, err := revision.Resolve(treeish)
+			if err != nil {
+				return "", err
+			}
+			if treeishes[i], err = revision.PeelTo(hash, "tree"); err != nil {
+				return "", err
+			}
+		}
+		oldTree, newTree = treeishes[0], treeishes[1]
+	default:
+		return "", fmt.Errorf("usage: mygit diff-tree [<options>] <tree-ish> [<tree-ish>] [<path>...]")
+	}
+
+	oldSide, newSide := &diffSnapshot{tree: oldTree}, &diffSnapshot{tree: newTree}
+	changes, err := compareSnapshots(oldSide, newSide, treeOptions, flags)
+	if err != nil {
+		return "", err
+	}
+	output, err := formatChanges(changes, oldSide, newSide, flags)
+	if err != nil || output == "" {
+		return output, err
+	}
+	return header + output, nil
+}
+
+// compareSnapshots lists the changes between two sides, limited to the
+// paths in options, and pairs up renames and copies if asked to.
+func compareSnapshots(oldSide *diffSnapshot, newSide *diffSnapshot, options diff.TreeOptions, flags diffFlags) (changes []diff.FileChange, err error) {
+	if oldSide.files == nil && newSide.files == nil {
+		if changes, err = diff.Trees(oldSide.tree, newSide.tree, options); err != nil {
+			return nil, err
+		}
+	} else {
+		oldFiles, err := oldSide.list(options.Paths)
+		if err != nil {
+			return nil, err
+		}
+		newFiles, err := newSide.list(options.Paths)
+		if err != nil {
+			return nil, err
+		}
+		changes = diff.Compare(oldFiles, newFiles)
+	}
+	if flags.renames == nil {
+		return changes, nil
+	}
+
+	renames := *flags.renames
+	if flags.copiesHarder {
+		oldFiles, err := oldSide.list(options.Paths)
+		if err != nil {
+			return nil, err
+		}
+		newFiles, err := newSide.list(options.Paths)
+		if err != nil {
+			return nil, err
+		}
+		for path, file := range oldFiles {
+			if newFiles[path] == file {
+				renames.Unchanged = append(renames.Unchanged, file)
+			}
+		}
+		sort.Slice(renames.Unchanged, func(i, j int) bool { return renames.Unchanged[i].Path < renames.Unchanged[j].Path })
+	}
+	return diff.DetectRenames(changes, renames, oldSide.read, newSide.read)
+}
+
+// formatChanges writes changes in the output format asked for.
+func formatChanges(changes []diff.FileChange, oldSide *diffSnapshot, newSide *diffSnapshot, flags diffFlags) (response string, err error) {
+	var result strings.Builder
+	stats := []diff.FileStat{}
+	for _, change := range changes {
+		switch {
+		case flags.output == "name-only":
+			result.WriteString(change.Path() + "\n")
+			continue
+		case flags.output == "name-status":
+			result.WriteString(change.StatusString() + "\t" + strings.Join(change.Paths(), "\t") + "\n")
+			continue
+		case flags.output == "raw":
+			result.WriteString(diff.Raw(change) + "\n")
+			continue
+		case change.Status == diff.Unmerged:
+			if flags.output == "patch" {
+				result.WriteString(fmt.Sprintf("* Unmerged path %s\n", change.Path()))
+			}
+			continue
+		}
+
+		oldData, err := oldSide.read(change.Old)
+		if err != nil {
+			return "", err
+		}
+		newData, err := newSide.read(change.New)
+		if err != nil {
+			return "", err
+		}
+		if flags.output == "patch" {
+			result.WriteString(diff.Patch(change, oldData, newData, flags.options))
+			continue
+		}
+		stat := diff.FileStat{Name: change.Path()}
+		if change.Status == diff.Renamed || change.Status == diff.Copied {
+			stat.Name = diff.RenameName(change.Old.Path, change.New.Path)
+		}
+		if diff.IsBinary(oldData) || diff.IsBinary(newData) {
+			stat.Binary, stat.OldSize, stat.NewSize = true, len(oldData), len(newData)
+		} else {
+			stat.Added, stat.Deleted = diff.Count(oldData, newData, flags.options)
+		}
+		stats = append(stats, stat)
+	}
+	if flags.output == "stat" && len(stats) > 0 {
+		result.WriteString(diff.Stat(stats, terminalWidth(), flags.options.Color))
+	}
+	if flags.summary {
+		for _, change := range changes {
+			result.WriteString(diff.Summary(change))
+		}
+	}
+	return result.String(), nil
+}
+
+// diffSides works out what to compare from the command line: the index
+// against the working tree, a commit (HEAD by default) against the index
+// with --cached, a commit against the working tree, or two commits. Trailing
+// arguments that aren't revisions but exist on disk are moved to paths.
+func diffSides(revisions []string, cached bool, paths *[]string) (oldSide *diffSnapshot, newSide *diffSnapshot, unmerged []string, err error) {
+	commits := []string{}
+	isRange := false
+	for i, arg := range revisions {
+		if !strings.Contains(arg, "..") {
+			hash, err := revision.Resolve(arg)
+			if err != nil {
+				if _, statErr := os.Stat(arg); statErr == nil {
+					*paths = append(revisions[i:], *paths...)
+					break
+				}
+				return nil, nil, nil, err
+			}
+			commits = append(commits, hash)
+			continue
+		}
+
+		spec, err := revision.ParseSpec(arg)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(spec.Exclude) == 0 {
+			return nil, nil, nil, fmt.Errorf("fatal: %s: no merge base", arg)
+		}
+		// A...B compares B with where it forked from A
+		commits = append(commits, spec.Exclude[0], spec.Include[0])
+		isRange = true
+	}
+
+	switch {
+	case len(commits) == 2:
+		if oldSide, err = treeSnapshot(commits[0]); err != nil {
+			return nil, nil, nil, err
+		}
+		newSide, err = treeSnapshot(commits[1])
+		return oldSide, newSide, nil, err
+	case len(commits) > 2 || isRange:
+		return nil, nil, nil, fmt.Errorf("usage: mygit diff [<options>] [<commit> [<commit>]] [--] [<path>...]")
+	}
+
+	idx, err := index.Read()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	indexSide, unmerged := indexSnapshot(idx)
+
+	if len(commits) == 1 {
+		if oldSide, err = treeSnapshot(commits[0]); err != nil {
+			return nil, nil, nil, err
+		}
+	} else if cached {
+		head, err := revision.Resolve("HEAD")
+		if err != nil {
+			// nothing is committed yet, so everything staged is new
+			head = ""
+		}
+		if oldSide, err = treeSnapshot(head); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	switch {
+	case cached:
+		return oldSide, indexSide, unmerged, nil
+	case oldSide == nil:
+		oldSide = indexSide
+	}
+	newSide, err = workTreeSnapshot(idx)
+	return oldSide, newSide, unmerged, err
+}
+
+// treeSnapshot is the tree of a commit or tree. An empty hash gives the
+// empty tree.
+func treeSnapshot(hash string) (snapshot *diffSnapshot, err error) {
+	if hash == "" {
+		return &diffSnapshot{}, nil
+	}
+	if hash, err = revision.PeelTo(hash, "tree"); err != nil {
+		return nil, err
+	}
+	return &diffSnapshot{tree: hash}, nil
+}
+
+// list returns the files of a side below paths, listing a tree's files
+// the first time.
+func (s *diffSnapshot) list(paths []string) (files map[string]diff.File, err error) {
+	if s.files == nil {
+		s.files = map[string]diff.File{}
+		if s.tree != "" {
+			if err := s.addTree(s.tree, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	files = map[string]diff.File{}
+	for path, file := range s.files {
+		if diff.MatchesPathspec(path, paths) {
+			files[path] = file
+		}
+	}
+	return files, nil
+}
+
+func (s *diffSnapshot) addTree(hash string, prefix string) (err error) {
+	_, data, err := gitobject.ReadObject(hash)
+	if err != nil {
+		return err
+	}
+	for _, node := range gitobject.ReadTree(len(data), bytes.NewReader(data)) {
+		path := prefix + node.Name
+		if node.Mode == 40000 {
+			if err := s.addTree(node.Hash, path+"/"); err != nil {
+				return err
+			}
+			continue
+		}
+		s.files[path] = diff.File{Path: path, Mode: node.Mode, Hash: node.Hash}
+	}
+	return nil
+}
+
+// indexSnapshot lists the merged entries of the index, and separately the
+// paths that still have conflicts.
+func indexSnapshot(idx *index.Index) (snapshot *diffSnapshot, unmerged []string) {
+	snapshot = &diffSnapshot{files: map[string]diff.File{}}
+	for _, entry := range idx.Entries {
+		if entry.Stage != 0 {
+			if len(unmerged) == 0 || unmerged[len(unmerged)-1] != entry.Path {
+				unmerged = append(unmerged, entry.Path)
+			}
+			continue
+		}
+		snapshot.files[entry.Path] = diff.File{Path: entry.Path, Mode: index.TreeMode(entry.Mode), Hash: entry.Hash}
+	}
+	return snapshot, unmerged
+}
+
+// workTreeSnapshot hashes the working tree copies of the files in the
+// index. Untracked files are left out, and files whose stat data still
+// matches the index keep the index's hash without being read.
+func workTreeSnapshot(idx *index.Index) (snapshot *diffSnapshot, err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	trustFileMode, err := cfg.GetBool("core.filemode", true)
+	if err != nil {
+		return nil, err
+	}
+	symlinks, err := cfg.GetBool("core.symlinks", true)
+	if err != nil {
+		return nil, err
+	}
+	indexInfo, err := os.Stat(".git/index")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	snapshot = &diffSnapshot{files: map[string]diff.File{}, blobs: map[string][]byte{}}
+	for i := range idx.Entries {
+		entry := &idx.Entries[i]
+		if entry.Stage != 0 {
+			continue
+		}
+		info, err := os.Lstat(entry.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		file := diff.File{Path: entry.Path, Mode: index.TreeMode(entry.Mode), Hash: entry.Hash}
+		var data []byte
+		switch {
+		case file.Mode == 160000:
+			// submodules are compared by the commit recorded in the index
+			snapshot.files[file.Path] = file
+			continue
+		case info.Mode()&fs.ModeSymlink != 0:
+			file.Mode = 120000
+			target, err := os.Readlink(entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			data = []byte(target)
+		case info.IsDir():
+			// a directory took the file's place, so the file is gone
+			continue
+		default:
+			// without symlinks, a link is checked out as a file holding its
+			// target and stays a link
+			if trustFileMode && (symlinks || file.Mode != 120000) {
+				file.Mode = 100644
+				if info.Mode()&0111 != 0 {
+					file.Mode = 100755
+				}
+			}
+			if indexInfo != nil && entry.StatMatches(info, indexInfo) {
+				snapshot.files[file.Path] = file
+				continue
+			}
+			if data, err = os.ReadFile(entry.Path); err != nil {
+				return nil, err
+			}
+		}
+		file.Hash = fmt.Sprintf("%x", gitobject.HashData(append([]byte(fmt.Sprintf("blob %d%c", len(data), 0)), data...)))
+		snapshot.blobs[file.Hash] = data
+		snapshot.files[file.Path] = file
+	}
+	return snapshot, nil
+}
+
+// read returns the content of one side of a change. Submodules are shown as
+// the commit they point at.
+func (s *diffSnapshot) read(file diff.File) (data []byte, err error) {
+	switch {
+	case file.Hash == "":
+		return nil, nil
+	case file.Mode == 160000:
+		return []byte(fmt.Sprintf("Subproject commit %s\n", file.Hash)), nil
+	}
+	if data, found := s.blobs[file.Hash]; found {
+		return data, nil
+	}
+	_, data, err = gitobject.ReadObject(file.Hash)
+	return data, err
+}
+
+// colorEnabled decides whether to color output from a --color value, or
+// when there is none, from color.<command> and color.ui. "auto" colors only
+// when writing to a terminal, and is git's default.
+func colorEnabled(cfg *config.Config, command string, value string) (enabled bool, err error) {
+	if value == "" {
+		value = "auto"
+		if configured, ok := cfg.Get("color." + command); ok {
+			value = configured
+		} else if configured, ok := cfg.Get("color.ui"); ok {
+			value = configured
+		}
+	}
+	switch value {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+	default:
+		// like git, true only means color on a terminal
+		if enabled, err = config.ParseBool(value); err != nil {
+			return false, fmt.Errorf("fatal: invalid color value: %s", value)
+		}
+		if !enabled {
+			return false, nil
+		}
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&fs.ModeCharDevice != 0, nil
+}
+
+// terminalWidth is the width of the terminal from $COLUMNS, or 80.
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 80
+}
@@ -0,0 +1,598 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitdate"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revision"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revwalk"
+)
+
+var countFlag = regexp.MustCompile(`^-\d+$`)
+
+type logFilter struct {
+	authors []*regexp.Regexp
+	greps   []*regexp.Regexp
+	since   *time.Time
+	until   *time.Time
+}
+
+func Log() (response string, err error) {
+	walker := revwalk.New()
+	filter := logFilter{}
+	format := "medium"
+	maxCount := -1
+	graph := false
+	revisions := []string{}
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case arg == "--":
+			walker.Paths = append(walker.Paths, args[i+1:]...)
+			i = len(args)
+		case arg == "--oneline":
+			format = "oneline-abbrev"
+		case name == "--format" || name == "--pretty":
+			format = value
+			if !hasValue {
+				format = "medium"
+			}
+		case arg == "-n" && i+1 < len(args):
+			i++
+			if maxCount, err = strconv.Atoi(args[i]); err != nil {
+				return "", fmt.Errorf("fatal: '%s': not an integer", args[i])
+			}
+		case name == "--max-count" || strings.HasPrefix(arg, "-n") || countFlag.MatchString(arg):
+			count := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "--max-count="), "-n"), "-")
+			if maxCount, err = strconv.Atoi(count); err != nil {
+				return "", fmt.Errorf("fatal: '%s': not an integer", count)
+			}
+		case arg == "--graph":
+			graph = true
+		case arg == "--all":
+			if err := pushAllRefs(walker); err != nil {
+				return "", err
+			}
+		case arg == "--first-parent":
+			walker.FirstParent = true
+		case name == "--author":
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return "", err
+			}
+			filter.authors = append(filter.authors, pattern)
+		case name == "--grep":
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return "", err
+			}
+			filter.greps = append(filter.greps, pattern)
+		case name == "--since" || name == "--after" || name == "--until" || name == "--before":
+			date, err := gitdate.Parse(value, time.Now())
+			if err != nil {
+				return "", err
+			}
+			if name == "--since" || name == "--after" {
+				filter.since = &date
+			} else {
+				filter.until = &date
+			}
+		case strings.HasPrefix(arg, "-"):
+			return "", fmt.Errorf("fatal: unrecognized argument: %s", arg)
+		default:
+			revisions = append(revisions, arg)
+		}
+	}
+
+	if err := pushRevisions(walker, revisions); err != nil {
+		return "", err
+	}
+	walker.TopoOrder = graph
+
+	var result strings.Builder
+	var lines *logGraph
+	if graph {
+		lines = &logGraph{}
+	}
+	shown := 0
+	for maxCount < 0 || shown < maxCount {
+		hash, commit, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if !filter.matches(commit) {
+			if lines != nil {
+				// keep the graph's columns in step with the history
+				lines.next(hash, walker.Parents(hash))
+			}
+			continue
+		}
+
+		text, separator, err := formatCommit(format, hash, commit)
+		if err != nil {
+			return "", err
+		}
+		if shown > 0 && separator {
+			result.WriteString(lines.prefix() + "\n")
+		}
+		shown++
+
+		if lines == nil {
+			result.WriteString(text)
+			continue
+		}
+		rows, padding := lines.next(hash, walker.Parents(hash))
+		textLines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		for i, line := range textLines {
+			prefix := padding
+			if i < len(rows) {
+				prefix = rows[i]
+			}
+			result.WriteString(prefix + line + "\n")
+		}
+		for _, row := range rows[min(len(textLines), len(rows)):] {
+			result.WriteString(row + "\n")
+		}
+	}
+	return result.String(), nil
+}
+
+// pushRevisions feeds command line revisions to a walker, starting from HEAD
+// when there are none. Arguments that aren't revisions but exist in the
+// working tree start the list of paths, like they do in git.
+func pushRevisions(walker *revwalk.Walker, revisions []string) (err error) {
+	included := false
+	for i, arg := range revisions {
+		spec, err := revision.ParseSpec(arg)
+		if err != nil {
+			if _, statErr := os.Stat(arg); statErr == nil {
+				walker.Paths = append(walker.Paths, revisions[i:]...)
+				break
+			}
+			return err
+		}
+		for _, hash := range spec.Include {
+			if hash, err = revision.PeelTo(hash, "commit"); err != nil {
+				return err
+			}
+			if err = walker.Push(hash); err != nil {
+				return err
+			}
+			included = true
+		}
+		for _, hash := range spec.Exclude {
+			if hash, err = revision.PeelTo(hash, "commit"); err != nil {
+				return err
+			}
+			if err = walker.Hide(hash); err != nil {
+				return err
+			}
+		}
+	}
+	if included {
+		return nil
+	}
+
+	head, err := revision.Resolve("HEAD")
+	if err != nil {
+		return fmt.Errorf("fatal: your current branch does not have any commits yet")
+	}
+	return walker.Push(head)
+}
+
+// pushAllRefs starts a walk from HEAD and every ref that leads to a commit.
+func pushAllRefs(walker *revwalk.Walker) (err error) {
+	all, err := refs.List("refs/")
+	if err != nil {
+		return err
+	}
+	if head, err := refs.Read("HEAD"); err == nil {
+		all = append(all, refs.Ref{Name: "HEAD", Hash: head})
+	}
+	for _, ref := range all {
+		hash, err := revision.PeelTo(ref.Hash, "commit")
+		if err != nil {
+			// tags may point at trees or blobs
+			continue
+		}
+		if err = walker.Push(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f logFilter) matches(commit *gitobject.Commit) bool {
+	if f.since != nil && commit.Committer.When.Before(*f.since) {
+		return false
+	}
+	if f.until != nil && commit.Committer.When.After(*f.until) {
+		return false
+	}
+	if len(f.authors) > 0 && !anyMatch(f.authors, commit.Author.Name+" <"+commit.Author.Email+">") {
+		return false
+	}
+	if len(f.greps) > 0 && !anyMatch(f.greps, commit.Message) {
+		return false
+	}
+	return true
+}
+
+func anyMatch(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatCommit renders a commit in one of git's pretty formats or a
+// format:/tformat: string. separator reports whether a blank line goes
+// between this commit and the previous one.
+func formatCommit(format string, hash string, commit *gitobject.Commit) (text string, separator bool, err error) {
+	message := strings.TrimRight(commit.Message, "\n")
+	indented := "    " + strings.ReplaceAll(message, "\n", "\n    ") + "\n"
+
+	var header strings.Builder
+	header.WriteString(fmt.Sprintf("commit %s\n", hash))
+	if len(commit.Parents) > 1 {
+		abbreviated := []string{}
+		for _, parent := range commit.Parents {
+			abbreviated = append(abbreviated, parent[:7])
+		}
+		header.WriteString(fmt.Sprintf("Merge: %s\n", strings.Join(abbreviated, " ")))
+	}
+	author := fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)
+	committer := fmt.Sprintf("%s <%s>", commit.Committer.Name, commit.Committer.Email)
+
+	switch format {
+	case "oneline":
+		return fmt.Sprintf("%s %s\n", hash, commit.Subject()), false, nil
+	case "oneline-abbrev":
+		return fmt.Sprintf("%s %s\n", hash[:7], commit.Subject()), false, nil
+	case "short":
+		return fmt.Sprintf("%sAuthor: %s\n\n    %s\n", header.String(), author, commit.Subject()), true, nil
+	case "medium":
+		return fmt.Sprintf("%sAuthor: %s\nDate:   %s\n\n%s", header.String(), author, commit.Author.When.Format(gitdate.DefaultLayout), indented), true, nil
+	case "full":
+		return fmt.Sprintf("%sAuthor: %s\nCommit: %s\n\n%s", header.String(), author, committer, indented), true, nil
+	case "fuller":
+		return fmt.Sprintf("%sAuthor:     %s\nAuthorDate: %s\nCommit:     %s\nCommitDate: %s\n\n%s",
+			header.String(), author, commit.Author.When.Format(gitdate.DefaultLayout),
+			committer, commit.Committer.When.Format(gitdate.DefaultLayout), indented), true, nil
+	}
+
+	if custom, found := strings.CutPrefix(format, "format:"); found {
+		// format: separates entries rather than terminating them
+		return expandPlaceholders(custom, hash, commit) + "\n", false, nil
+	}
+	custom, found := strings.CutPrefix(format, "tformat:")
+	if !found && !strings.Contains(custom, "%") {
+		return "", false, fmt.Errorf("fatal: invalid --pretty format: %s", format)
+	}
+	return expandPlaceholders(custom, hash, commit) + "\n", false, nil
+}
+
+// expandPlaceholders fills in the %-placeholders of a custom format.
+func expandPlaceholders(format string, hash string, commit *gitobject.Commit) string {
+	now := time.Now()
+	subject, body, _ := strings.Cut(commit.Message, "\n\n")
+	dates := func(when time.Time, style byte) (string, bool) {
+		switch style {
+		case 'd':
+			return when.Format(gitdate.DefaultLayout), true
+		case 't':
+			return strconv.FormatInt(when.Unix(), 10), true
+		case 'r':
+			return gitdate.FormatRelative(when, now), true
+		case 'i':
+			return when.Format(gitdate.ISOLayout), true
+		case 'I':
+			return when.Format(gitdate.StrictISOLayout), true
+		}
+		return "", false
+	}
+	abbreviate := func(hashes []string) string {
+		short := []string{}
+		for _, h := range hashes {
+			short = append(short, h[:7])
+		}
+		return strings.Join(short, " ")
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			result.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case '%':
+			result.WriteByte('%')
+		case 'n':
+			result.WriteByte('\n')
+		case 'x':
+			// %xNN is the byte with that hex value, as in %x09 for a tab
+			if i+2 < len(format) {
+				if value, err := strconv.ParseUint(format[i+1:i+3], 16, 8); err == nil {
+					result.WriteByte(byte(value))
+					i += 2
+					continue
+				}
+			}
+			result.WriteString(format[i-1 : i+1])
+		case 'H':
+			result.WriteString(hash)
+		case 'h':
+			result.WriteString(hash[:7])
+		case 'T':
+			result.WriteString(commit.Tree)
+		case 't':
+			result.WriteString(commit.Tree[:7])
+		case 'P':
+			result.WriteString(strings.Join(commit.Parents, " "))
+		case 'p':
+			result.WriteString(abbreviate(commit.Parents))
+		case 's':
+			result.WriteString(strings.Join(strings.Split(strings.TrimSpace(subject), "\n"), " "))
+		case 'b':
+			result.WriteString(body)
+		case 'B':
+			result.WriteString(commit.Message)
+		case 'a', 'c':
+			signature := commit.Author
+			if format[i] == 'c' {
+				signature = commit.Committer
+			}
+			if i+1 >= len(format) {
+				result.WriteString(format[i-1:])
+				continue
+			}
+			i++
+			switch format[i] {
+			case 'n':
+				result.WriteString(signature.Name)
+			case 'e':
+				result.WriteString(signature.Email)
+			default:
+				if date, ok := dates(signature.When, format[i]); ok {
+					result.WriteString(date)
+				} else {
+					result.WriteString(format[i-2 : i+1])
+				}
+			}
+		default:
+			// unknown placeholders are shown as they are
+			result.WriteString(format[i-1 : i+1])
+		}
+	}
+	return result.String()
+}
+
+// logGraph draws the lines of --graph. Each column holds the commit expected
+// next on that line of history.
+type logGraph struct {
+	columns []string
+}
+
+// next returns the rows drawn alongside a commit's text: the row with its
+// marker, followed by any rows drawing a merge or lines joining up. padding
+// continues the columns for text beyond those rows.
+func (g *logGraph) next(hash string, parents []string) (rows []string, padding string) {
+	position := -1
+	for i, column := range g.columns {
+		if column == hash {
+			position = i
+			break
+		}
+	}
+	if position < 0 {
+		g.columns = append(g.columns, hash)
+		position = len(g.columns) - 1
+	}
+
+	columns := append([]string{}, g.columns[:position]...)
+	columns = append(columns, parents...)
+	columns = append(columns, g.columns[position+1:]...)
+	width := 2 * max(len(g.columns), len(columns))
+
+	row := g.row(width)
+	row[2*position] = '*'
+	rows = append(rows, string(row))
+
+	if len(parents) > 1 {
+		row := g.row(width)
+		for i := position + 1; i < len(g.columns); i++ {
+			row[2*i] = ' '
+			row[2*i+1] = '\\'
+		}
+		row[2*position+1] = '\\'
+		rows = append(rows, string(row))
+	}
+
+	g.columns = columns
+	for {
+		duplicate := -1
+		for i := len(g.columns) - 1; i > 0; i-- {
+			if slices.Index(g.columns, g.columns[i]) < i {
+				duplicate = i
+			}
+		}
+		if duplicate < 0 {
+			break
+		}
+		row := g.row(width)
+		for i := duplicate; i < len(g.columns); i++ {
+			row[2*i] = ' '
+			row[2*i-1] = '/'
+		}
+		rows = append(rows, string(row))
+		g.columns = append(g.columns[:duplicate], g.columns[duplicate+1:]...)
+	}
+
+	return rows, string(g.row(width))
+}
+
+// row draws every current column as a straight line.
+func (g *logGraph) row(width int) []byte {
+	row := []byte(strings.Repeat(" ", width))
+	for i := range g.columns {
+		row[2*i] = '|'
+	}
+	return row
+}
+
+// prefix is the graph drawn before a line between commits. A nil graph
+// draws nothing.
+func (g *logGraph) prefix() string {
+	if g == nil {
+		return ""
+	}
+	return string(g.row(2 * len(g.columns)))
+}
+
+func RevList() (response string, err error) {
+	walker := revwalk.New()
+	filter := revwalk.NoFilter
+	objects, count, reverse, printOmitted, not, all := false, false, false, false, false, false
+	missing := "error"
+	maxCount := -1
+	revisions := []string{}
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, _ := strings.Cut(arg, "=")
+		switch {
+		case arg == "--":
+			walker.Paths = append(walker.Paths, args[i+1:]...)
+			i = len(args)
+		case arg == "--objects":
+			objects = true
+		case arg == "--count":
+			count = true
+		case arg == "--reverse":
+			reverse = true
+		case arg == "--topo-order":
+			walker.TopoOrder = true
+		case arg == "--date-order":
+		case arg == "--first-parent":
+			walker.FirstParent = true
+		case arg == "--not":
+			not = !not
+		case arg == "--all":
+			all = true
+			if err := pushAllRefs(walker); err != nil {
+				return "", err
+			}
+		case name == "--missing":
+			if value != "error" && value != "print" && value != "allow-any" {
+				return "", fmt.Errorf("fatal: invalid value for '--missing': '%s'", value)
+			}
+			missing = value
+		case name == "--filter":
+			if filter, err = revwalk.ParseFilter(value); err != nil {
+				return "", fmt.Errorf("fatal: %s", err)
+			}
+		case arg == "--filter-print-omitted":
+			printOmitted = true
+		case arg == "-n" && i+1 < len(args):
+			i++
+			if maxCount, err = strconv.Atoi(args[i]); err != nil {
+				return "", fmt.Errorf("fatal: '%s': not an integer", args[i])
+			}
+		case name == "--max-count" || strings.HasPrefix(arg, "-n") || countFlag.MatchString(arg):
+			limit := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "--max-count="), "-n"), "-")
+			if maxCount, err = strconv.Atoi(limit); err != nil {
+				return "", fmt.Errorf("fatal: '%s': not an integer", limit)
+			}
+		case strings.HasPrefix(arg, "-"):
+			return "", fmt.Errorf("fatal: unrecognized argument: %s", arg)
+		case not:
+			// --not flips whether the revisions after it are included
+			if excluded, found := strings.CutPrefix(arg, "^"); found {
+				revisions = append(revisions, excluded)
+			} else {
+				revisions = append(revisions, "^"+arg)
+			}
+		default:
+			revisions = append(revisions, arg)
+		}
+	}
+	if len(revisions) == 0 && !all {
+		return "", fmt.Errorf("usage: mygit rev-list [<options>] <commit>... [--] [<path>...]")
+	}
+	if err := pushRevisions(walker, revisions); err != nil {
+		return "", err
+	}
+
+	commits := []string{}
+	for maxCount < 0 || len(commits) < maxCount {
+		hash, _, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		commits = append(commits, hash)
+	}
+	if count {
+		return fmt.Sprintf("%d\n", len(commits)), nil
+	}
+	if reverse {
+		slices.Reverse(commits)
+	}
+
+	var result strings.Builder
+	for _, hash := range commits {
+		result.WriteString(hash + "\n")
+	}
+	if !objects {
+		return result.String(), nil
+	}
+	omitted, absent := []string{}, []string{}
+	err = walker.Objects(commits, filter, func(object revwalk.Object) error {
+		switch {
+		case object.Missing && missing == "error":
+			return fmt.Errorf("fatal: missing %s %s", object.Type, object.Hash)
+		case object.Missing && missing == "print":
+			absent = append(absent, object.Hash)
+		case object.Missing:
+		case object.Omitted:
+			omitted = append(omitted, object.Hash)
+		default:
+			result.WriteString(fmt.Sprintf("%s %s\n", object.Hash, object.Path))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if printOmitted {
+		for _, hash := range omitted {
+			result.WriteString(fmt.Sprintf("~%s\n", hash))
+		}
+	}
+	for _, hash := range absent {
+		result.WriteString(fmt.Sprintf("?%s\n", hash))
+	}
+	return result.String(), nil
+}
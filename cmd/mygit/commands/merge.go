@@ -0,0 +1,549 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/git"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/merge"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revision"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revwalk"
+)
+
+// files that hold a merge stopped by conflicts
+const (
+	mergeHeadFile = ".git/MERGE_HEAD"
+	mergeMsgFile  = ".git/MERGE_MSG"
+	mergeModeFile = ".git/MERGE_MODE"
+)
+
+const unmergedHint = "hint: Fix them up in the work tree and mark them resolved in the index,\n" +
+	"hint: then finish with 'mygit merge --continue'.\n" +
+	"fatal: Exiting because of an unresolved conflict."
+
+// Merge joins another commit's history into the current branch, by moving
+// the branch forward when that is possible and with a merge commit
+// otherwise. Conflicts stop the merge with the index and working tree
+// holding them, to be resolved and finished with --continue, or undone with
+// --abort.
+func Merge() (response string, err error) {
+	mergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+	ff := mergeCmd.Bool("ff", false, "fast-forward when possible")
+	noFF := mergeCmd.Bool("no-ff", false, "always create a merge commit")
+	ffOnly := mergeCmd.Bool("ff-only", false, "refuse to merge unless it is a fast-forward")
+	message := mergeCmd.String("m", "", "message for the merge commit")
+	stat := mergeCmd.Bool("stat", false, "show a diffstat of the merge")
+	noStat := mergeCmd.Bool("no-stat", false, "don't show a diffstat of the merge")
+	mergeCmd.BoolVar(noStat, "n", false, "don't show a diffstat of the merge")
+	mergeCmd.Bool("no-edit", false, "accepted for compatibility; the message is never edited")
+	continueMerge := mergeCmd.Bool("continue", false, "commit a merge once its conflicts are resolved")
+	abort := mergeCmd.Bool("abort", false, "give up on a merge and go back to how things were")
+	mergeCmd.Parse(os.Args[2:])
+
+	switch {
+	case *abort:
+		return abortMerge()
+	case *continueMerge:
+		return concludeMerge()
+	case mergeCmd.NArg() != 1:
+		return "", fmt.Errorf("usage: mygit merge [--ff | --no-ff | --ff-only] [-m <message>] <commit>\n   or: mygit merge --continue\n   or: mygit merge --abort")
+	}
+	name := mergeCmd.Arg(0)
+
+	current, err := index.Read()
+	if err != nil {
+		return "", err
+	}
+	if len(current.Unmerged()) > 0 {
+		return "", fmt.Errorf("error: Merging is not possible because you have unmerged files.\n%s", unmergedHint)
+	}
+	if _, err := os.Stat(mergeHeadFile); err == nil {
+		return "", fmt.Errorf("fatal: You have not concluded your merge (MERGE_HEAD exists).\nPlease, commit your changes before you merge.")
+	}
+
+	theirs, err := revision.Resolve(name)
+	if err == nil {
+		theirs, err = revision.PeelTo(theirs, "commit")
+	}
+	if err != nil {
+		return "", fmt.Errorf("merge: %s - not something we can merge", name)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	showStat, err := cfg.GetBool("merge.stat", true)
+	if err != nil {
+		return "", err
+	}
+	showStat = (showStat || *stat) && !*noStat
+	fastForward := "true"
+	if value, ok := cfg.Get("merge.ff"); ok {
+		fastForward = strings.ToLower(value)
+		if fastForward != "only" {
+			enabled, err := config.ParseBool(value)
+			if err != nil {
+				return "", err
+			}
+			fastForward = fmt.Sprint(enabled)
+		}
+	}
+	switch {
+	case *ffOnly:
+		fastForward = "only"
+	case *noFF:
+		fastForward = "false"
+	case *ff:
+		fastForward = "true"
+	}
+	reflogAction := "merge " + name
+
+	head, err := refs.Read("HEAD")
+	if errors.Is(err, refs.ErrNotFound) {
+		// an unborn branch simply starts at the merged commit
+		if err := checkoutMerged("", theirs); err != nil {
+			return "", err
+		}
+		return "", refs.Update("HEAD", theirs, "", reflogAction+": Fast-forward")
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := refs.Write("ORIG_HEAD", head, ""); err != nil {
+		return "", err
+	}
+
+	bases, err := revwalk.MergeBases([]string{head}, []string{theirs})
+	if err != nil {
+		return "", err
+	}
+	for _, base := range bases {
+		if base == theirs {
+			return "Already up to date.\n", nil
+		}
+	}
+	canFastForward := len(bases) == 1 && bases[0] == head
+	if fastForward == "only" && !canFastForward {
+		return "", fmt.Errorf("fatal: Not possible to fast-forward, aborting.")
+	}
+
+	if canFastForward && fastForward != "false" {
+		if err := checkoutMerged(head, theirs); err != nil {
+			return "", err
+		}
+		if err := refs.Update("HEAD", theirs, head, reflogAction+": Fast-forward"); err != nil {
+			return "", err
+		}
+		response = fmt.Sprintf("Updating %s..%s\nFast-forward\n", head[:7], theirs[:7])
+		if showStat {
+			summary, err := mergeStat(cfg, head, theirs)
+			if err != nil {
+				return "", err
+			}
+			response += summary
+		}
+		return response, nil
+	}
+
+	headIndex, err := git.CommitIndex(head)
+	if err != nil {
+		return "", err
+	}
+	if staged := stagedChanges(current, headIndex); len(staged) > 0 {
+		return "", fmt.Errorf("error: Your local changes to the following files would be overwritten by merge:\n\t%s\nPlease commit your changes or stash them before you merge.\nAborting", strings.Join(staged, "\n\t"))
+	}
+
+	options := merge.Options{OurLabel: "HEAD", TheirLabel: name}
+	if style, ok := cfg.Get("merge.conflictStyle"); ok && (style == "diff3" || style == "zdiff3") {
+		options.Diff3 = true
+	}
+	result, err := merge.Commits(head, theirs, options)
+	if err != nil {
+		return "", err
+	}
+	merged := []index.Entry{}
+	for _, file := range result.Files {
+		merged = append(merged, index.Entry{Path: file.Path, Mode: index.EntryMode(file.Mode), Hash: file.Hash})
+	}
+	if err := git.UpdateWorkTree(headIndex.Entries, merged, result.Index(), "merge", false); err != nil {
+		return "", err
+	}
+	messages := ""
+	for _, line := range result.Messages {
+		messages += line + "\n"
+	}
+
+	if *message == "" {
+		*message = mergeMessage(name)
+	}
+	if !result.Clean() {
+		conflicts := "\n# Conflicts:\n"
+		for _, path := range result.Index().Unmerged() {
+			conflicts += "#\t" + path + "\n"
+		}
+		mode := ""
+		if fastForward == "false" {
+			mode = "no-ff"
+		}
+		for file, content := range map[string]string{mergeHeadFile: theirs + "\n", mergeMsgFile: *message + "\n" + conflicts, mergeModeFile: mode} {
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				return "", err
+			}
+		}
+		fmt.Print(messages)
+		return "", fmt.Errorf("Automatic merge failed; fix conflicts and then commit the result.")
+	}
+
+	tree, err := result.Tree()
+	if err != nil {
+		return "", err
+	}
+	hash, err := writeCommit(cfg, tree, []string{head, theirs}, *message+"\n")
+	if err != nil {
+		return "", err
+	}
+	if err := refs.Update("HEAD", hash, head, reflogAction+": Merge made by the 'ort' strategy."); err != nil {
+		return "", err
+	}
+	response = messages + "Merge made by the 'ort' strategy.\n"
+	if showStat {
+		summary, err := mergeStat(cfg, head, hash)
+		if err != nil {
+			return "", err
+		}
+		response += summary
+	}
+	return response, nil
+}
+
+// mergeMessage is the default message for merging name, saying what kind of
+// ref it is and which branch it goes into, unless that is main or master.
+func mergeMessage(name string) string {
+	kind, shortName := "commit", name
+	if fullName, _ := revision.SymbolicFullName(name); fullName != "" {
+		for _, namespace := range []struct{ prefix, kind string }{
+			{"refs/heads/", "branch"},
+			{"refs/remotes/", "remote-tracking branch"},
+			{"refs/tags/", "tag"},
+		} {
+			if short, found := strings.CutPrefix(fullName, namespace.prefix); found {
+				kind, shortName = namespace.kind, short
+			}
+		}
+	}
+	message := fmt.Sprintf("Merge %s '%s'", kind, shortName)
+
+	into := "HEAD"
+	if target, err := refs.ReadSymbolic("HEAD"); err == nil {
+		into = strings.TrimPrefix(target, "refs/heads/")
+	}
+	if into != "main" && into != "master" {
+		message += " into " + into
+	}
+	return message
+}
+
+// concludeMerge commits a merge stopped by conflicts once the index has
+// none left, with the message saved for it.
+func concludeMerge() (response string, err error) {
+	mergeHeads, err := os.ReadFile(mergeHeadFile)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("fatal: There is no merge in progress (MERGE_HEAD missing).")
+	}
+	if err != nil {
+		return "", err
+	}
+	current, err := index.Read()
+	if err != nil {
+		return "", err
+	}
+	if unmerged := current.Unmerged(); len(unmerged) > 0 {
+		return "", fmt.Errorf("error: Committing is not possible because you have unmerged files.\n%s\nU\t%s", unmergedHint, strings.Join(unmerged, "\nU\t"))
+	}
+	tree, err := current.WriteTree()
+	if err != nil {
+		return "", err
+	}
+
+	head, err := refs.Read("HEAD")
+	if err != nil {
+		return "", err
+	}
+	parents := append([]string{head}, strings.Fields(string(mergeHeads))...)
+	message, err := os.ReadFile(mergeMsgFile)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	cleaned := cleanupMessage(string(message))
+	if cleaned == "" {
+		return "", fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	hash, err := writeCommit(cfg, tree, parents, cleaned)
+	if err != nil {
+		return "", err
+	}
+	subject := strings.SplitN(cleaned, "\n", 2)[0]
+	if err := refs.Update("HEAD", hash, head, "commit (merge): "+subject); err != nil {
+		return "", err
+	}
+	if err := removeMergeState(); err != nil {
+		return "", err
+	}
+
+	branch := "detached HEAD"
+	if target, err := refs.ReadSymbolic("HEAD"); err == nil {
+		branch = strings.TrimPrefix(target, "refs/heads/")
+	}
+	return fmt.Sprintf("[%s %s] %s\n", branch, hash[:7], subject), nil
+}
+
+// abortMerge puts the index and the files the merge touched back the way
+// HEAD has them and forgets the merge.
+func abortMerge() (response string, err error) {
+	if _, err := os.Stat(mergeHeadFile); os.IsNotExist(err) {
+		return "", fmt.Errorf("fatal: There is no merge to abort (MERGE_HEAD missing).")
+	}
+	head, err := refs.Read("HEAD")
+	if err != nil {
+		return "", err
+	}
+	headIndex, err := git.CommitIndex(head)
+	if err != nil {
+		return "", err
+	}
+	current, err := index.Read()
+	if err != nil {
+		return "", err
+	}
+
+	// conflicted paths hold something other than any version, so they
+	// always get reset
+	merged := []index.Entry{}
+	for _, entry := range current.Entries {
+		if entry.Stage == 0 {
+			merged = append(merged, entry)
+		}
+	}
+	for _, path := range current.Unmerged() {
+		merged = append(merged, index.Entry{Path: path})
+	}
+	if err := git.UpdateWorkTree(merged, headIndex.Entries, headIndex, "merge", true); err != nil {
+		return "", err
+	}
+	return "", removeMergeState()
+}
+
+func removeMergeState() (err error) {
+	for _, file := range []string{mergeHeadFile, mergeMsgFile, mergeModeFile} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupMessage strips comment lines and trailing whitespace from a commit
+// message, and blank lines from its ends, like git's default cleanup.
+func cleanupMessage(message string) string {
+	lines := []string{}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// checkoutMerged moves the working tree and index from one commit to
+// another for a fast-forward. An empty from is an unborn branch.
+func checkoutMerged(from string, to string) (err error) {
+	fromIndex := &index.Index{}
+	if from != "" {
+		if fromIndex, err = git.CommitIndex(from); err != nil {
+			return err
+		}
+	}
+	toIndex, err := git.CommitIndex(to)
+	if err != nil {
+		return err
+	}
+	return git.UpdateWorkTree(fromIndex.Entries, toIndex.Entries, toIndex, "merge", false)
+}
+
+// stagedChanges lists the paths where the index differs from a commit's.
+func stagedChanges(current *index.Index, committed *index.Index) (paths []string) {
+	files := map[string]index.Entry{}
+	for _, entry := range committed.Entries {
+		files[entry.Path] = entry
+	}
+	for _, entry := range current.Entries {
+		if committedEntry, found := files[entry.Path]; !found || committedEntry.Hash != entry.Hash || committedEntry.Mode != entry.Mode {
+			paths = append(paths, entry.Path)
+		}
+		delete(files, entry.Path)
+	}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// mergeStat is the diffstat and summary of what a merge brought in.
+func mergeStat(cfg *config.Config, oldCommit string, newCommit string) (response string, err error) {
+	flags := diffFlags{options: diff.DefaultOptions(), output: "stat", summary: true, recursive: true}
+	if flags.renames, err = configuredRenames(cfg); err != nil {
+		return "", err
+	}
+	oldSide, err := treeSnapshot(oldCommit)
+	if err != nil {
+		return "", err
+	}
+	newSide, err := treeSnapshot(newCommit)
+	if err != nil {
+		return "", err
+	}
+	changes, err := compareSnapshots(oldSide, newSide, diff.TreeOptions{Recursive: true}, flags)
+	if err != nil {
+		return "", err
+	}
+	return formatChanges(changes, oldSide, newSide, flags)
+}
+
+func MergeBase() (response string, err error) {
+	mergeBaseCmd := flag.NewFlagSet("merge-base", flag.ExitOnError)
+	all := mergeBaseCmd.Bool("a", false, "print all merge bases, not just one")
+	mergeBaseCmd.BoolVar(all, "all", false, "print all merge bases, not just one")
+	isAncestor := mergeBaseCmd.Bool("is-ancestor", false, "exit with 0 if the first commit is an ancestor of the second, 1 if not")
+	octopus := mergeBaseCmd.Bool("octopus", false, "find the merge bases for an octopus merge of all the commits")
+	independent := mergeBaseCmd.Bool("independent", false, "list the commits no other given commit can reach")
+	forkPoint := mergeBaseCmd.Bool("fork-point", false, "find where a commit forked from a ref, using the ref's reflog")
+	args := parseInterspersed(mergeBaseCmd, os.Args[2:])
+
+	usage := fmt.Errorf("usage: mygit merge-base [-a | --all] <commit> <commit>...\n   or: mygit merge-base [-a | --all] --octopus <commit>...\n   or: mygit merge-base --is-ancestor <commit> <commit>\n   or: mygit merge-base --independent <commit>...\n   or: mygit merge-base --fork-point <ref> [<commit>]")
+	switch {
+	case *forkPoint:
+		if len(args) < 1 || len(args) > 2 {
+			return "", usage
+		}
+		return mergeBaseForkPoint(args)
+	case *isAncestor:
+		if len(args) != 2 {
+			return "", fmt.Errorf("fatal: --is-ancestor takes exactly two commits")
+		}
+		if *all {
+			return "", fmt.Errorf("fatal: options '--is-ancestor' and '--all' cannot be used together")
+		}
+	case *independent && *all:
+		return "", fmt.Errorf("fatal: options '--independent' and '--all' cannot be used together")
+	case !*octopus && !*independent && len(args) < 2:
+		return "", usage
+	}
+
+	commits := []string{}
+	for _, arg := range args {
+		commit, err := mergeBaseCommit(arg)
+		if err != nil {
+			return "", err
+		}
+		commits = append(commits, commit)
+	}
+
+	var bases []string
+	switch {
+	case *isAncestor:
+		found, err := revwalk.IsAncestor(commits[0], commits[1])
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			os.Exit(1)
+		}
+		return "", nil
+	case *independent:
+		bases, err = revwalk.Independent(commits)
+		*all = true
+	case *octopus:
+		bases, err = revwalk.OctopusMergeBases(commits)
+	default:
+		bases, err = revwalk.MergeBases(commits[:1], commits[1:])
+	}
+	if err != nil {
+		return "", err
+	}
+	// like git, finding nothing is only said through the exit code
+	if len(bases) == 0 {
+		os.Exit(1)
+	}
+	if !*all {
+		bases = bases[:1]
+	}
+	return strings.Join(bases, "\n") + "\n", nil
+}
+
+func mergeBaseForkPoint(args []string) (response string, err error) {
+	refName, err := refs.Dwim(args[0])
+	if err == nil {
+		// like git, HEAD means the branch it is on
+		refName, _, err = refs.Resolve(refName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fatal: No such ref: '%s'", args[0])
+	}
+	name := "HEAD"
+	if len(args) == 2 {
+		name = args[1]
+	}
+	hash, err := revision.Resolve(name)
+	if err != nil {
+		return "", fmt.Errorf("fatal: Not a valid object name: '%s'", name)
+	}
+	commit, err := revision.PeelTo(hash, "commit")
+	if err != nil {
+		return "", fmt.Errorf("fatal: Not a valid commit name %s", name)
+	}
+	forkPoint, err := revwalk.ForkPoint(refName, commit)
+	if err != nil {
+		return "", err
+	}
+	if forkPoint == "" {
+		os.Exit(1)
+	}
+	return forkPoint + "\n", nil
+}
+
+func mergeBaseCommit(name string) (commit string, err error) {
+	hash, err := revision.Resolve(name)
+	if err != nil {
+		return "", fmt.Errorf("fatal: Not a valid object name %s", name)
+	}
+	if commit, err = revision.PeelTo(hash, "commit"); err != nil {
+		return "", fmt.Errorf("fatal: Not a valid commit name %s", name)
+	}
+	return commit, nil
+}
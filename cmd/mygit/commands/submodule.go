@@ -0,0 +1,231 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/git"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/githttp"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitpack"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/remote"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/submodule"
+)
+
+func Submodule() (response string, err error) {
+	usage := fmt.Errorf("usage: mygit submodule init [<path>...]\n   or: mygit submodule update [--init] [<path>...]")
+	if len(os.Args) < 3 {
+		return "", usage
+	}
+	switch os.Args[2] {
+	case "init":
+		return submoduleInit(os.Args[3:])
+	case "update":
+		updateCmd := flag.NewFlagSet("submodule update", flag.ExitOnError)
+		initialize := updateCmd.Bool("init", false, "initialize the submodules first")
+		paths := parseInterspersed(updateCmd, os.Args[3:])
+		if !*initialize {
+			return submoduleUpdate(paths)
+		}
+		response, err := submoduleInit(paths)
+		if err != nil {
+			return "", err
+		}
+		updated, err := submoduleUpdate(paths)
+		return response + updated, err
+	}
+	return "", usage
+}
+
+// submoduleInit copies the URLs of the submodules in .gitmodules into the
+// repository's config, which is what marks them for update. Relative URLs
+// are resolved against origin's.
+func submoduleInit(paths []string) (response string, err error) {
+	submodules, err := selectSubmodules(paths)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+
+	for _, module := range submodules {
+		key := "submodule." + module.Name + ".url"
+		if _, ok := cfg.Get(key); ok {
+			continue
+		}
+		if module.URL == "" {
+			return "", fmt.Errorf("fatal: No url found for submodule path '%s' in .gitmodules", module.Path)
+		}
+		url := module.URL
+		if base, ok := cfg.Get("remote.origin.url"); ok {
+			url = submodule.ResolveURL(url, base)
+		} else if wd, err := os.Getwd(); err == nil {
+			url = submodule.ResolveURL(url, wd)
+		}
+		if err := config.Set("submodule."+module.Name+".active", "true"); err != nil {
+			return "", err
+		}
+		if err := config.Set(key, url); err != nil {
+			return "", err
+		}
+		response += fmt.Sprintf("Submodule '%s' (%s) registered for path '%s'\n", module.Name, url, module.Path)
+	}
+	return response, nil
+}
+
+// submoduleUpdate clones the initialized submodules that aren't there yet
+// and checks out the commit the index records for each, detaching their
+// HEAD. Unlike git, which keeps a submodule's repository under
+// .git/modules, the clone's .git directory is inside the submodule.
+func submoduleUpdate(paths []string) (response string, err error) {
+	submodules, err := selectSubmodules(paths)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return "", err
+	}
+	top, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for _, module := range submodules {
+		url, ok := cfg.Get("submodule." + module.Name + ".url")
+		if !ok {
+			continue
+		}
+		entry, found := idx.Find(module.Path, 0)
+		if !found || index.TreeMode(entry.Mode) != 160000 {
+			continue
+		}
+		updated, err := updateSubmodule(module, url, entry.Hash, top)
+		// each submodule is worked on from inside it
+		if chdirErr := os.Chdir(top); err == nil {
+			err = chdirErr
+		}
+		if err != nil {
+			return "", err
+		}
+		response += updated
+	}
+	return response, nil
+}
+
+// updateSubmodule brings one submodule to the commit hash, cloning it from
+// url first if needed. It leaves the process inside the submodule.
+func updateSubmodule(module submodule.Submodule, url string, hash string, top string) (response string, err error) {
+	if _, err := os.Stat(filepath.Join(module.Path, ".git")); os.IsNotExist(err) {
+		response += fmt.Sprintf("Cloning into '%s'...\n", filepath.Join(top, module.Path))
+		if err := cloneRepository(remote.NormalizeUrl(url), module.Path); err != nil {
+			return "", fmt.Errorf("%w\nfatal: clone of '%s' into submodule path '%s' failed", err, url, filepath.Join(top, module.Path))
+		}
+	} else if err := os.Chdir(module.Path); err != nil {
+		return "", err
+	}
+
+	if head, err := refs.Read("HEAD"); err == nil && head == hash && refs.IsDetached() {
+		return response, nil
+	}
+	if _, err := gitobject.Type(hash); err != nil {
+		// a submodule cloned earlier may not have the commit yet
+		if fetchErr := fetchSubmodule(hash); fetchErr != nil {
+			fmt.Fprintln(os.Stderr, fetchErr)
+		}
+		if _, err := gitobject.Type(hash); err != nil {
+			return "", fmt.Errorf("fatal: Fetched in submodule path '%s', but it did not contain %s. Direct fetching of that commit failed.", module.Path, hash)
+		}
+	}
+	if err := git.CheckoutDetached(hash); err != nil {
+		return "", fmt.Errorf("%w\nfatal: Unable to checkout '%s' in submodule path '%s'", err, hash, module.Path)
+	}
+	return response + fmt.Sprintf("Submodule path '%s': checked out '%s'\n", module.Path, hash), nil
+}
+
+// fetchSubmodule fetches the branches and tags of the current submodule's
+// origin, updating its remote-tracking refs. If hash still isn't there, it
+// asks for hash itself, which only servers allowing unadvertised commits
+// answer.
+func fetchSubmodule(hash string) (err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	url, ok := cfg.Get("remote.origin.url")
+	if !ok {
+		return fmt.Errorf("fatal: 'origin' does not appear to be a git repository")
+	}
+	url = remote.NormalizeUrl(url)
+	client, err := githttp.NewClient(url)
+	if err != nil {
+		return err
+	}
+	advertisement, err := remote.Discover(client, url)
+	if err != nil {
+		return err
+	}
+
+	if wants := advertisedWants(advertisement); len(wants) > 0 {
+		if err := fetchObjects(client, url, advertisement, wants); err != nil {
+			return err
+		}
+		if defaultBranch, err := advertisement.DefaultBranch(); err == nil {
+			if err := writeRemoteTrackingRefs(advertisement, defaultBranch, "origin", "fetch: from "+url); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := gitobject.Type(hash); err == nil {
+		return nil
+	}
+	return fetchObjects(client, url, advertisement, []string{hash})
+}
+
+// fetchObjects fetches everything reachable from wants into the current
+// repository.
+func fetchObjects(client *githttp.Client, url string, advertisement *remote.Advertisement, wants []string) (err error) {
+	pack, err := advertisement.FetchPack(client, url, wants)
+	if err != nil {
+		return err
+	}
+	defer pack.Close()
+	return gitpack.Unpack(".", pack)
+}
+
+// selectSubmodules returns the submodules in .gitmodules at the given
+// paths, or all of them when there are none.
+func selectSubmodules(paths []string) (selected []submodule.Submodule, err error) {
+	submodules, err := submodule.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return submodules, nil
+	}
+	for _, path := range paths {
+		path = filepath.ToSlash(filepath.Clean(path))
+		found := false
+		for _, module := range submodules {
+			if module.Path == path {
+				selected = append(selected, module)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("error: pathspec '%s' did not match any file(s) known to git", path)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,454 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type entry struct {
+	key   string
+	value string
+}
+
+// Config holds every key/value pair read from the config files, in the order
+// they were read, so later files and later lines override earlier ones.
+type Config struct {
+	entries []entry
+}
+
+// Load reads the system, global and repository config files. Missing files are
+// skipped.
+func Load() (config *Config, err error) {
+	config = &Config{}
+	for _, path := range configPaths() {
+		if err := config.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// LoadFile reads a single file in config syntax, like .gitmodules. A missing
+// file is empty.
+func LoadFile(path string) (config *Config, err error) {
+	config = &Config{}
+	if err := config.readFile(path); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func configPaths() []string {
+	paths := []string{}
+	if os.Getenv("GIT_CONFIG_NOSYSTEM") == "" {
+		paths = append(paths, "/etc/gitconfig")
+	}
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); global != "" {
+		paths = append(paths, global)
+	} else {
+		xdgHome := os.Getenv("XDG_CONFIG_HOME")
+		home, _ := os.UserHomeDir()
+		if xdgHome == "" && home != "" {
+			xdgHome = filepath.Join(home, ".config")
+		}
+		if xdgHome != "" {
+			paths = append(paths, filepath.Join(xdgHome, "git", "config"))
+		}
+		if home != "" {
+			paths = append(paths, filepath.Join(home, ".gitconfig"))
+		}
+	}
+	return append(paths, repositoryConfig)
+}
+
+// Get returns the last value set for key.
+func (c *Config) Get(key string) (value string, ok bool) {
+	key = NormalizeKey(key)
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].key == key {
+			return c.entries[i].value, true
+		}
+	}
+	return "", false
+}
+
+// GetAll returns every value set for key, in the order they were read.
+func (c *Config) GetAll(key string) []string {
+	key = NormalizeKey(key)
+	values := []string{}
+	for _, entry := range c.entries {
+		if entry.key == key {
+			values = append(values, entry.value)
+		}
+	}
+	return values
+}
+
+func (c *Config) GetBool(key string, defaultValue bool) (value bool, err error) {
+	raw, ok := c.Get(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	return ParseBool(raw)
+}
+
+func (c *Config) GetInt(key string, defaultValue int) (value int, err error) {
+	raw, ok := c.Get(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	return ParseInt(raw)
+}
+
+// Subsections returns the distinct subsection names used under section, e.g.
+// the remote names for section "remote".
+func (c *Config) Subsections(section string) []string {
+	prefix := strings.ToLower(section) + "."
+	seen := map[string]bool{}
+	names := []string{}
+	for _, entry := range c.entries {
+		if !strings.HasPrefix(entry.key, prefix) {
+			continue
+		}
+		rest := entry.key[len(prefix):]
+		dot := strings.LastIndex(rest, ".")
+		if dot < 0 {
+			continue
+		}
+		name := rest[:dot]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func ParseBool(raw string) (value bool, err error) {
+	switch strings.ToLower(raw) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("bad boolean config value '%s'", raw)
+}
+
+// ParseInt understands the k, m and g suffixes git allows on integer values.
+func ParseInt(raw string) (value int, err error) {
+	multiplier := 1
+	if len(raw) > 0 {
+		switch raw[len(raw)-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			raw = raw[:len(raw)-1]
+		}
+	}
+	value, err = strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("bad numeric config value '%s'", raw)
+	}
+	return value * multiplier, nil
+}
+
+// NormalizeKey lowercases the section and variable name of a key while leaving
+// the subsection untouched, since only the subsection is case sensitive.
+func NormalizeKey(key string) string {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first < 0 {
+		return strings.ToLower(key)
+	}
+	if first == last {
+		return strings.ToLower(key)
+	}
+	return strings.ToLower(key[:first]) + key[first:last] + strings.ToLower(key[last:])
+}
+
+func normalizeSection(section string) string {
+	name, subsection, found := strings.Cut(section, ".")
+	if !found {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name) + "." + subsection
+}
+
+func (c *Config) readFile(path string) (err error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			lineNumber++
+			line = line[:len(line)-1] + scanner.Text()
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return fmt.Errorf("bad config line %d in file %s", lineNumber, path)
+			}
+			section = parseSectionHeader(line[1:end])
+			line = strings.TrimSpace(line[end+1:])
+			if line == "" || line[0] == '#' || line[0] == ';' {
+				continue
+			}
+		}
+		if section == "" {
+			return fmt.Errorf("bad config line %d in file %s", lineNumber, path)
+		}
+
+		name, value := line, "true"
+		if equals := strings.Index(line, "="); equals >= 0 {
+			name = strings.TrimSpace(line[:equals])
+			value = parseValue(line[equals+1:])
+		}
+		c.entries = append(c.entries, entry{section + "." + strings.ToLower(name), value})
+	}
+	return scanner.Err()
+}
+
+func parseSectionHeader(header string) string {
+	header = strings.TrimSpace(header)
+	if quote := strings.Index(header, "\""); quote >= 0 {
+		name := strings.ToLower(strings.TrimSpace(header[:quote]))
+		subsection := strings.TrimSuffix(header[quote+1:], "\"")
+		subsection = strings.NewReplacer("\\\"", "\"", "\\\\", "\\").Replace(subsection)
+		return name + "." + subsection
+	}
+	// the deprecated [section.subsection] syntax lowercases the subsection
+	return strings.ToLower(header)
+}
+
+func parseValue(raw string) string {
+	var value strings.Builder
+	inQuotes := false
+	pendingSpace := ""
+	raw = strings.TrimSpace(raw)
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			value.WriteString(pendingSpace)
+			pendingSpace = ""
+			inQuotes = !inQuotes
+		case !inQuotes && (c == '#' || c == ';'):
+			return value.String()
+		case c == '\\' && i+1 < len(raw):
+			i++
+			value.WriteString(pendingSpace)
+			pendingSpace = ""
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'b':
+				value.WriteByte('\b')
+			default:
+				value.WriteByte(raw[i])
+			}
+			continue
+		case !inQuotes && (c == ' ' || c == '\t'):
+			pendingSpace += string(c)
+			continue
+		default:
+			value.WriteString(pendingSpace)
+			pendingSpace = ""
+			value.WriteByte(c)
+		}
+	}
+	return value.String()
+}
+
+// Set writes key = value to the repository config file, replacing the last
+// existing value for key or adding the key (and its section) when missing.
+func Set(key string, value string) (err error) {
+	key = NormalizeKey(key)
+	dot := strings.LastIndex(key, ".")
+	if dot < 0 {
+		return fmt.Errorf("key does not contain a section: %s", key)
+	}
+	section, name := key[:dot], key[dot+1:]
+	line := fmt.Sprintf("\t%s = %s", name, quoteValue(value))
+
+	lines, err := readLines(repositoryConfig)
+	if err != nil {
+		return err
+	}
+
+	replaceAt, sectionEnd := -1, -1
+	current := ""
+	for i, text := range lines {
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "[") {
+			if end := strings.Index(trimmed, "]"); end >= 0 {
+				current = parseSectionHeader(trimmed[1:end])
+			}
+			continue
+		}
+		if current != section {
+			continue
+		}
+		sectionEnd = i
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+		lineName, _, _ := strings.Cut(trimmed, "=")
+		if strings.ToLower(strings.TrimSpace(lineName)) == name {
+			replaceAt = i
+		}
+	}
+
+	switch {
+	case replaceAt >= 0:
+		lines[replaceAt] = line
+	case sectionEnd >= 0:
+		lines = append(lines[:sectionEnd+1], append([]string{line}, lines[sectionEnd+1:]...)...)
+	default:
+		lines = append(lines, sectionHeader(section), line)
+	}
+	return writeLines(repositoryConfig, lines)
+}
+
+const repositoryConfig = ".git/config"
+
+func sectionHeader(section string) string {
+	name, subsection, found := strings.Cut(section, ".")
+	if !found {
+		return fmt.Sprintf("[%s]", name)
+	}
+	subsection = strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(subsection)
+	return fmt.Sprintf("[%s \"%s\"]", name, subsection)
+}
+
+func quoteValue(value string) string {
+	escaped := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t").Replace(value)
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;") {
+		return "\"" + escaped + "\""
+	}
+	return escaped
+}
+
+func readLines(path string) (lines []string, err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return []string{}, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func writeLines(path string, lines []string) (err error) {
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// Identity returns the name and email recorded for role, which is "author" or
+// "committer", taking GIT_<ROLE>_NAME/EMAIL over user.name and user.email.
+func (c *Config) Identity(role string) (name string, email string) {
+	name = os.Getenv(fmt.Sprintf("GIT_%s_NAME", strings.ToUpper(role)))
+	email = os.Getenv(fmt.Sprintf("GIT_%s_EMAIL", strings.ToUpper(role)))
+	if name == "" {
+		name, _ = c.Get("user.name")
+	}
+	if email == "" {
+		email, _ = c.Get("user.email")
+	}
+	if email == "" {
+		email = os.Getenv("EMAIL")
+	}
+
+	if name == "" || email == "" {
+		username := "unknown"
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+		if name == "" {
+			name = username
+		}
+		if email == "" {
+			hostname, _ := os.Hostname()
+			email = fmt.Sprintf("%s@%s", username, hostname)
+		}
+	}
+	return name, email
+}
+
+// RemoveSection deletes a whole section, e.g. "branch.topic", from the
+// repository config file.
+func RemoveSection(section string) (err error) {
+	lines, err := readLines(repositoryConfig)
+	if err != nil {
+		return err
+	}
+	section = normalizeSection(section)
+
+	kept := []string{}
+	inSection := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if end := strings.Index(trimmed, "]"); end >= 0 {
+				inSection = parseSectionHeader(trimmed[1:end]) == section
+			}
+		}
+		if !inSection {
+			kept = append(kept, line)
+		}
+	}
+	return writeLines(repositoryConfig, kept)
+}
+
+// RenameSection renames every header of section in the repository config
+// file, e.g. when a branch is renamed.
+func RenameSection(oldSection string, newSection string) (err error) {
+	lines, err := readLines(repositoryConfig)
+	if err != nil {
+		return err
+	}
+	oldSection = normalizeSection(oldSection)
+	newSection = normalizeSection(newSection)
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "[") {
+			continue
+		}
+		if end := strings.Index(trimmed, "]"); end >= 0 && parseSectionHeader(trimmed[1:end]) == oldSection {
+			lines[i] = sectionHeader(newSection) + trimmed[end+1:]
+		}
+	}
+	return writeLines(repositoryConfig, lines)
+}
@@ -0,0 +1,1007 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type Algorithm int
+
+const (
+	Myers Algorithm = iota
+	Histogram
+)
+
+// Options control how lines are compared and how much context surrounds
+// each hunk.
+type Options struct {
+	Algorithm Algorithm
+	// Context is the number of unchanged lines shown around changes.
+	Context int
+	// IgnoreAllSpace compares lines with all whitespace removed (-w).
+	IgnoreAllSpace bool
+	// IgnoreSpaceChange treats runs of whitespace as a single space and
+	// ignores whitespace at the end of lines (-b).
+	IgnoreSpaceChange bool
+	// Color adds git's terminal colors to patches.
+	Color bool
+}
+
+// DefaultOptions match git's defaults: Myers with three lines of context.
+func DefaultOptions() Options {
+	return Options{Algorithm: Myers, Context: 3}
+}
+
+// ParseAlgorithm reads the names accepted by --diff-algorithm.
+func ParseAlgorithm(name string) (algorithm Algorithm, err error) {
+	switch name {
+	case "myers", "default":
+		return Myers, nil
+	case "histogram":
+		return Histogram, nil
+	}
+	return 0, fmt.Errorf("unknown diff algorithm '%s'", name)
+}
+
+// Change is a region that differs: old lines [OldStart, OldEnd) were
+// replaced by new lines [NewStart, NewEnd). Either side may be empty.
+type Change struct {
+	OldStart int
+	OldEnd   int
+	NewStart int
+	NewEnd   int
+}
+
+// Line is one line of a hunk. Op is ' ' for context, '-' for a removed line
+// and '+' for an added one. Text keeps its newline, if it had one.
+type Line struct {
+	Op   byte
+	Text string
+}
+
+type Hunk struct {
+	OldStart int
+	OldCount int
+	NewStart int
+	NewCount int
+	// Function is the nearest line above the hunk that looks like the start
+	// of a function, shown after the range like git does.
+	Function string
+	Lines    []Line
+}
+
+// binaryCheckLength is how much of a file git looks at for a NUL byte.
+const binaryCheckLength = 8000
+
+// IsBinary guesses whether data is binary the way git does without
+// attributes: it is if a NUL byte appears near the start.
+func IsBinary(data []byte) bool {
+	if len(data) > binaryCheckLength {
+		data = data[:binaryCheckLength]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// Lines splits data after each newline. A final line without one is kept.
+func Lines(data []byte) []string {
+	lines := []string{}
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		lines = append(lines, string(data[:end]))
+		data = data[end:]
+	}
+	return lines
+}
+
+// Changes compares two lists of lines and returns the regions that differ,
+// in order.
+func Changes(a []string, b []string, options Options) []Change {
+	keysA, keysB := keys(a, b, options)
+	changedA := make([]bool, len(a)+1)
+	changedB := make([]bool, len(b)+1)
+	switch options.Algorithm {
+	case Histogram:
+		histogram(keysA, keysB, 0, len(a), 0, len(b), changedA, changedB)
+	default:
+		myers(keysA, keysB, 0, len(a), 0, len(b), changedA, changedB)
+	}
+	compact(a, keysA, changedA, changedB)
+	compact(b, keysB, changedB, changedA)
+	return buildChanges(changedA, changedB, len(a), len(b))
+}
+
+// Hunks groups changes with their surrounding context into unified diff
+// hunks. Changes separated by no more than twice the context share a hunk.
+func Hunks(a []string, b []string, options Options) []Hunk {
+	changes := Changes(a, b, options)
+	hunks := []Hunk{}
+	function := ""
+	functionLimit := -1
+	for i := 0; i < len(changes); {
+		last := i
+		for last+1 < len(changes) && changes[last+1].OldStart-changes[last].OldEnd <= 2*options.Context {
+			last++
+		}
+
+		first := changes[i]
+		oldStart := max(first.OldStart-options.Context, 0)
+		newStart := max(first.NewStart-options.Context, 0)
+		oldEnd := min(changes[last].OldEnd+options.Context, len(a))
+		newEnd := min(changes[last].NewEnd+options.Context, len(b))
+
+		// look back as far as the previous hunk, and keep its function
+		// when there is nothing newer
+		if line, found := functionLine(a, oldStart-1, functionLimit); found {
+			function = line
+		}
+		functionLimit = oldStart - 1
+
+		hunk := Hunk{
+			OldStart: oldStart,
+			OldCount: oldEnd - oldStart,
+			NewStart: newStart,
+			NewCount: newEnd - newStart,
+			Function: function,
+		}
+		// context comes from the new side, which matters when whitespace is
+		// ignored
+		newLine := newStart
+		for _, change := range changes[i : last+1] {
+			for ; newLine < change.NewStart; newLine++ {
+				hunk.Lines = append(hunk.Lines, Line{' ', b[newLine]})
+			}
+			for _, line := range a[change.OldStart:change.OldEnd] {
+				hunk.Lines = append(hunk.Lines, Line{'-', line})
+			}
+			for _, line := range b[change.NewStart:change.NewEnd] {
+				hunk.Lines = append(hunk.Lines, Line{'+', line})
+			}
+			newLine = change.NewEnd
+		}
+		for ; newLine < newEnd; newLine++ {
+			hunk.Lines = append(hunk.Lines, Line{' ', b[newLine]})
+		}
+		hunks = append(hunks, hunk)
+		i = last + 1
+	}
+	return hunks
+}
+
+// Header formats the @@ line that introduces a hunk.
+func (h Hunk) Header() string {
+	header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldCount), hunkRange(h.NewStart, h.NewCount))
+	if h.Function != "" {
+		header += " " + h.Function
+	}
+	return header
+}
+
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// Unified formats the hunks between two contents, without file headers.
+func Unified(oldData []byte, newData []byte, options Options) string {
+	var result strings.Builder
+	for _, hunk := range Hunks(Lines(oldData), Lines(newData), options) {
+		result.WriteString(hunk.Header() + "\n")
+		for _, line := range hunk.Lines {
+			result.WriteString(FormatLine(line))
+		}
+	}
+	return result.String()
+}
+
+// FormatLine writes a hunk line, marking a missing final newline.
+func FormatLine(line Line) string {
+	if strings.HasSuffix(line.Text, "\n") {
+		return string(line.Op) + line.Text
+	}
+	return string(line.Op) + line.Text + "\n\\ No newline at end of file\n"
+}
+
+// functionLine searches upwards from start, stopping before limit, for a line
+// that starts with a letter, '_' or '$', which is git's default idea of a
+// function header.
+func functionLine(lines []string, start int, limit int) (function string, found bool) {
+	for i := start; i > limit && i >= 0; i-- {
+		line := lines[i]
+		if len(line) == 0 {
+			continue
+		}
+		c := line[0]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$' {
+			line = strings.TrimRight(line, " \t\n\r\v\f")
+			if len(line) > 80 {
+				line = line[:80]
+			}
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// keys maps lines to numbers that are equal exactly when the lines compare
+// equal under the whitespace options.
+func keys(a []string, b []string, options Options) (keysA []int, keysB []int) {
+	ids := map[string]int{}
+	key := func(line string) int {
+		normalized := line
+		switch {
+		case options.IgnoreAllSpace:
+			normalized = strings.Join(strings.Fields(line), "")
+		case options.IgnoreSpaceChange:
+			normalized = collapseSpace(line)
+		}
+		id, ok := ids[normalized]
+		if !ok {
+			id = len(ids)
+			ids[normalized] = id
+		}
+		return id
+	}
+	for _, line := range a {
+		keysA = append(keysA, key(line))
+	}
+	for _, line := range b {
+		keysB = append(keysB, key(line))
+	}
+	return keysA, keysB
+}
+
+// collapseSpace turns every run of whitespace into one space and drops
+// whitespace at the end of the line.
+func collapseSpace(line string) string {
+	var result strings.Builder
+	inSpace := false
+	for _, c := range line {
+		if isSpace(byte(c)) && c < 0x80 {
+			inSpace = true
+			continue
+		}
+		if inSpace {
+			result.WriteByte(' ')
+			inSpace = false
+		}
+		result.WriteRune(c)
+	}
+	return result.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// myers marks the lines outside a shortest edit script between
+// a[lowA:highA] and b[lowB:highB] as changed, following git's xdiff so the
+// same script is picked when several are equally short. Lines that only
+// appear on one side are changed for certain and are left out of the search,
+// as are lines that match too often when they sit amongst such lines.
+func myers(a []int, b []int, lowA int, highA int, lowB int, highB int, changedA []bool, changedB []bool) {
+	// matches are counted over the whole region, common ends included
+	countA, countB := map[int]int{}, map[int]int{}
+	for _, key := range a[lowA:highA] {
+		countA[key]++
+	}
+	for _, key := range b[lowB:highB] {
+		countB[key]++
+	}
+	limitA := min(bogoSqrt(highA-lowA), maxEqualLimit)
+	limitB := min(bogoSqrt(highB-lowB), maxEqualLimit)
+
+	for lowA < highA && lowB < highB && a[lowA] == b[lowB] {
+		lowA++
+		lowB++
+	}
+	for lowA < highA && lowB < highB && a[highA-1] == b[highB-1] {
+		highA--
+		highB--
+	}
+	keptA, indexA := discard(a, lowA, highA, countB, limitA, changedA)
+	keptB, indexB := discard(b, lowB, highB, countA, limitB, changedB)
+
+	search := &myersSearch{
+		a:        keptA,
+		b:        keptB,
+		changedA: changedA,
+		changedB: changedB,
+		indexA:   indexA,
+		indexB:   indexB,
+		offset:   len(keptB) + 1,
+		maxCost:  max(bogoSqrt(len(keptA)+len(keptB)+3), 256),
+	}
+	search.forward = make([]int, len(keptA)+len(keptB)+3)
+	search.backward = make([]int, len(keptA)+len(keptB)+3)
+	search.compare(0, len(keptA), 0, len(keptB), false)
+}
+
+const (
+	maxEqualLimit    = 1024
+	similarWindow    = 100
+	keepDiscardedRun = 4
+	heuristicMinCost = 256
+	snakeCount       = 20
+	heuristicFactor  = 4
+)
+
+// discard returns the lines of a region worth searching, with their
+// positions, and marks the rest as changed. Lines matching limit or more
+// times in the other file count as matching too often.
+func discard(lines []int, low int, high int, otherCount map[int]int, limit int, changed []bool) (kept []int, index []int) {
+	matches := make([]int, high-low)
+	for i, key := range lines[low:high] {
+		switch count := otherCount[key]; {
+		case count == 0:
+			matches[i] = 0
+		case count >= limit:
+			matches[i] = 2
+		default:
+			matches[i] = 1
+		}
+	}
+	for i, key := range lines[low:high] {
+		if matches[i] == 1 || (matches[i] == 2 && !discardMultimatch(matches, i)) {
+			kept = append(kept, key)
+			index = append(index, low+i)
+		} else {
+			changed[low+i] = true
+		}
+	}
+	return kept, index
+}
+
+// discardMultimatch decides whether a line with many matches is surrounded
+// by enough lines without any to be treated as changed too.
+func discardMultimatch(matches []int, i int) bool {
+	start, end := max(0, i-similarWindow), min(len(matches)-1, i+similarWindow)
+
+	unmatchedBefore, multipleBefore := 0, 1
+	for r := 1; i-r >= start; r++ {
+		if matches[i-r] == 0 {
+			unmatchedBefore++
+		} else if matches[i-r] == 2 {
+			multipleBefore++
+		} else {
+			break
+		}
+	}
+	if unmatchedBefore == 0 {
+		return false
+	}
+	unmatchedAfter, multipleAfter := 0, 1
+	for r := 1; i+r <= end; r++ {
+		if matches[i+r] == 0 {
+			unmatchedAfter++
+		} else if matches[i+r] == 2 {
+			multipleAfter++
+		} else {
+			break
+		}
+	}
+	if unmatchedAfter == 0 {
+		return false
+	}
+	unmatched := unmatchedBefore + unmatchedAfter
+	multiple := multipleBefore + multipleAfter
+	return multiple*keepDiscardedRun < multiple+unmatched
+}
+
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// myersSearch holds the state of the divide and conquer search. forward and
+// backward hold the furthest reaching paths for each diagonal i - j.
+type myersSearch struct {
+	a, b               []int
+	changedA, changedB []bool
+	indexA, indexB     []int
+	forward, backward  []int
+	offset             int
+	maxCost            int
+}
+
+func (s *myersSearch) compare(lowA int, highA int, lowB int, highB int, needMinimal bool) {
+	for lowA < highA && lowB < highB && s.a[lowA] == s.b[lowB] {
+		lowA++
+		lowB++
+	}
+	for lowA < highA && lowB < highB && s.a[highA-1] == s.b[highB-1] {
+		highA--
+		highB--
+	}
+
+	switch {
+	case lowA == highA:
+		for ; lowB < highB; lowB++ {
+			s.changedB[s.indexB[lowB]] = true
+		}
+	case lowB == highB:
+		for ; lowA < highA; lowA++ {
+			s.changedA[s.indexA[lowA]] = true
+		}
+	default:
+		splitA, splitB, minimalLow, minimalHigh := s.split(lowA, highA, lowB, highB, needMinimal)
+		s.compare(lowA, splitA, lowB, splitB, minimalLow)
+		s.compare(splitA, highA, splitB, highB, minimalHigh)
+	}
+}
+
+// split finds where a shortest edit script crosses the middle of the box,
+// searching from both corners at once. Past a certain cost it settles for a
+// good enough split instead, unless needMinimal is set.
+func (s *myersSearch) split(lowA int, highA int, lowB int, highB int, needMinimal bool) (splitA int, splitB int, minimalLow bool, minimalHigh bool) {
+	a, b := s.a, s.b
+	forward := func(d int) *int { return &s.forward[s.offset+d] }
+	backward := func(d int) *int { return &s.backward[s.offset+d] }
+
+	minDiagonal, maxDiagonal := lowA-highB, highA-lowB
+	forwardMid, backwardMid := lowA-lowB, highA-highB
+	odd := (forwardMid-backwardMid)&1 != 0
+	forwardMin, forwardMax := forwardMid, forwardMid
+	backwardMin, backwardMax := backwardMid, backwardMid
+
+	*forward(forwardMid) = lowA
+	*backward(backwardMid) = highA
+
+	for cost := 1; ; cost++ {
+		gotSnake := false
+
+		// widen the range of diagonals by one, or shrink it back in where it
+		// would leave the box
+		if forwardMin > minDiagonal {
+			forwardMin--
+			*forward(forwardMin - 1) = -1
+		} else {
+			forwardMin++
+		}
+		if forwardMax < maxDiagonal {
+			forwardMax++
+			*forward(forwardMax + 1) = -1
+		} else {
+			forwardMax--
+		}
+
+		for d := forwardMax; d >= forwardMin; d -= 2 {
+			var i int
+			if *forward(d - 1) >= *forward(d + 1) {
+				i = *forward(d - 1) + 1
+			} else {
+				i = *forward(d + 1)
+			}
+			previous := i
+			j := i - d
+			for i < highA && j < highB && a[i] == b[j] {
+				i++
+				j++
+			}
+			if i-previous > snakeCount {
+				gotSnake = true
+			}
+			*forward(d) = i
+			if odd && backwardMin <= d && d <= backwardMax && *backward(d) <= i {
+				return i, j, true, true
+			}
+		}
+
+		if backwardMin > minDiagonal {
+			backwardMin--
+			*backward(backwardMin - 1) = math.MaxInt
+		} else {
+			backwardMin++
+		}
+		if backwardMax < maxDiagonal {
+			backwardMax++
+			*backward(backwardMax + 1) = math.MaxInt
+		} else {
+			backwardMax--
+		}
+
+		for d := backwardMax; d >= backwardMin; d -= 2 {
+			var i int
+			if *backward(d - 1) < *backward(d + 1) {
+				i = *backward(d - 1)
+			} else {
+				i = *backward(d + 1) - 1
+			}
+			previous := i
+			j := i - d
+			for i > lowA && j > lowB && a[i-1] == b[j-1] {
+				i--
+				j--
+			}
+			if previous-i > snakeCount {
+				gotSnake = true
+			}
+			*backward(d) = i
+			if !odd && forwardMin <= d && d <= forwardMax && i <= *forward(d) {
+				return i, j, true, true
+			}
+		}
+
+		if needMinimal {
+			continue
+		}
+
+		// once the script gets expensive, take a long enough snake that has
+		// made good progress as the split
+		if gotSnake && cost > heuristicMinCost {
+			best := 0
+			for d := forwardMax; d >= forwardMin; d -= 2 {
+				distance := d - forwardMid
+				if distance < 0 {
+					distance = -distance
+				}
+				i := *forward(d)
+				j := i - d
+				value := (i - lowA) + (j - lowB) - distance
+				if value > heuristicFactor*cost && value > best &&
+					lowA+snakeCount <= i && i < highA && lowB+snakeCount <= j && j < highB {
+					for k := 1; a[i-k] == b[j-k]; k++ {
+						if k == snakeCount {
+							best = value
+							splitA, splitB = i, j
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return splitA, splitB, true, false
+			}
+
+			for d := backwardMax; d >= backwardMin; d -= 2 {
+				distance := d - backwardMid
+				if distance < 0 {
+					distance = -distance
+				}
+				i := *backward(d)
+				j := i - d
+				value := (highA - i) + (highB - j) - distance
+				if value > heuristicFactor*cost && value > best &&
+					lowA < i && i <= highA-snakeCount && lowB < j && j <= highB-snakeCount {
+					for k := 0; a[i+k] == b[j+k]; k++ {
+						if k == snakeCount-1 {
+							best = value
+							splitA, splitB = i, j
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return splitA, splitB, false, true
+			}
+		}
+
+		// enough is enough: split at whichever path got furthest
+		if cost >= s.maxCost {
+			forwardBest, forwardBestA := -1, -1
+			for d := forwardMax; d >= forwardMin; d -= 2 {
+				i := min(*forward(d), highA)
+				j := i - d
+				if highB < j {
+					i, j = highB+d, highB
+				}
+				if forwardBest < i+j {
+					forwardBest, forwardBestA = i+j, i
+				}
+			}
+			backwardBest, backwardBestA := math.MaxInt, math.MaxInt
+			for d := backwardMax; d >= backwardMin; d -= 2 {
+				i := max(lowA, *backward(d))
+				j := i - d
+				if j < lowB {
+					i, j = lowB+d, lowB
+				}
+				if i+j < backwardBest {
+					backwardBest, backwardBestA = i+j, i
+				}
+			}
+			if (highA+highB)-backwardBest < forwardBest-(lowA+lowB) {
+				return forwardBestA, forwardBest - forwardBestA, true, false
+			}
+			return backwardBestA, backwardBest - backwardBestA, false, true
+		}
+	}
+}
+
+// maxChainLength is how often a line may occur and still be used as an
+// anchor by the histogram algorithm.
+const maxChainLength = 64
+
+// histogram splits a region on the longest run of matching lines whose
+// rarest line occurs least often in a, then diffs either side of it,
+// following git's xhistogram. Unlike Myers it doesn't skip the common ends
+// first, as they can belong to a better run. A region whose common lines
+// all occur too often falls back to Myers, and one without common lines is
+// all changed.
+func histogram(a []int, b []int, lowA int, highA int, lowB int, highB int, changedA []bool, changedB []bool) {
+	for lowA < highA && lowB < highB {
+		occurrences := map[int][]int{}
+		for i := lowA; i < highA; i++ {
+			occurrences[a[i]] = append(occurrences[a[i]], i)
+		}
+
+		bestCount := maxChainLength + 1
+		bestLength := 0
+		bestA, bestB := -1, -1
+		hasCommon := false
+		for j := lowB; j < highB; {
+			next := j + 1
+			positions := occurrences[b[j]]
+			hasCommon = hasCommon || len(positions) > 0
+			if len(positions) > bestCount {
+				j = next
+				continue
+			}
+			for p := 0; p < len(positions); {
+				startA, startB := positions[p], j
+				endA, endB := startA+1, j+1
+				// the rarest line in the matched region decides how good
+				// it is
+				count := len(positions)
+				for startA > lowA && startB > lowB && a[startA-1] == b[startB-1] {
+					startA--
+					startB--
+					count = min(count, len(occurrences[a[startA]]))
+				}
+				for endA < highA && endB < highB && a[endA] == b[endB] {
+					count = min(count, len(occurrences[a[endA]]))
+					endA++
+					endB++
+				}
+				// lines of b inside a match aren't tried on their own
+				next = max(next, endB)
+				if endA-startA > bestLength || count < bestCount {
+					bestCount, bestLength = count, endA-startA
+					bestA, bestB = startA, startB
+				}
+				// nor are the occurrences in a that it covers
+				for p < len(positions) && positions[p] < endA {
+					p++
+				}
+			}
+			j = next
+		}
+
+		if hasCommon && bestCount > maxChainLength {
+			myers(a, b, lowA, highA, lowB, highB, changedA, changedB)
+			return
+		}
+		if bestA < 0 {
+			break
+		}
+		histogram(a, b, lowA, bestA, lowB, bestB, changedA, changedB)
+		lowA, lowB = bestA+bestLength, bestB+bestLength
+	}
+	markChanged(lowA, highA, lowB, highB, changedA, changedB)
+}
+
+func markChanged(lowA int, highA int, lowB int, highB int, changedA []bool, changedB []bool) {
+	for i := lowA; i < highA; i++ {
+		changedA[i] = true
+	}
+	for i := lowB; i < highB; i++ {
+		changedB[i] = true
+	}
+}
+
+func buildChanges(changedA []bool, changedB []bool, lengthA int, lengthB int) []Change {
+	changes := []Change{}
+	i, j := 0, 0
+	for i < lengthA || j < lengthB {
+		if (i < lengthA && changedA[i]) || (j < lengthB && changedB[j]) {
+			change := Change{OldStart: i, NewStart: j}
+			for i < lengthA && changedA[i] {
+				i++
+			}
+			for j < lengthB && changedB[j] {
+				j++
+			}
+			change.OldEnd, change.NewEnd = i, j
+			changes = append(changes, change)
+			continue
+		}
+		i++
+		j++
+	}
+	return changes
+}
+
+// group is a run of changed lines [start, end) in one file. Every stretch of
+// unchanged lines is followed by a group, which may be empty, so the groups
+// of both files can be stepped through side by side.
+type group struct {
+	start int
+	end   int
+}
+
+func firstGroup(changed []bool) group {
+	g := group{}
+	for changed[g.end] {
+		g.end++
+	}
+	return g
+}
+
+func (g *group) next(changed []bool) bool {
+	if g.end == len(changed)-1 {
+		return false
+	}
+	g.start = g.end + 1
+	g.end = g.start
+	for changed[g.end] {
+		g.end++
+	}
+	return true
+}
+
+func (g *group) previous(changed []bool) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	g.start = g.end
+	for g.start > 0 && changed[g.start-1] {
+		g.start--
+	}
+	return true
+}
+
+// slideDown moves the group down a line, which works when the line after it
+// matches its first line, and joins any group it runs into.
+func (g *group) slideDown(keys []int, changed []bool) bool {
+	if g.end >= len(keys) || keys[g.start] != keys[g.end] {
+		return false
+	}
+	changed[g.start] = false
+	changed[g.end] = true
+	g.start++
+	g.end++
+	for changed[g.end] {
+		g.end++
+	}
+	return true
+}
+
+func (g *group) slideUp(keys []int, changed []bool) bool {
+	if g.start == 0 || keys[g.start-1] != keys[g.end-1] {
+		return false
+	}
+	g.start--
+	g.end--
+	changed[g.start] = true
+	changed[g.end] = false
+	for g.start > 0 && changed[g.start-1] {
+		g.start--
+	}
+	return true
+}
+
+// maxSliding bounds how many positions the indent heuristic tries.
+const maxSliding = 100
+
+// compact slides each group of changes in one file to where it reads best,
+// as git does: lined up with changes in the other file when possible, and
+// otherwise where the indent heuristic likes it most.
+func compact(lines []string, keys []int, changed []bool, otherChanged []bool) {
+	g := firstGroup(changed)
+	other := firstGroup(otherChanged)
+	for {
+		if g.end != g.start {
+			var size, earliestEnd int
+			endMatchingOther := -1
+			// sliding can merge groups, so repeat until the size settles
+			for {
+				size = g.end - g.start
+				endMatchingOther = -1
+				for g.slideUp(keys, changed) {
+					other.previous(otherChanged)
+				}
+				earliestEnd = g.end
+				if other.end > other.start {
+					endMatchingOther = g.end
+				}
+				for g.slideDown(keys, changed) {
+					other.next(otherChanged)
+					if other.end > other.start {
+						endMatchingOther = g.end
+					}
+				}
+				if size == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+			case endMatchingOther != -1:
+				for other.end == other.start {
+					g.slideUp(keys, changed)
+					other.previous(otherChanged)
+				}
+			default:
+				shift := max(earliestEnd, g.end-size-1, g.end-maxSliding)
+				bestShift := -1
+				var best splitScore
+				for ; shift <= g.end; shift++ {
+					score := splitScore{}
+					score.add(measureSplit(lines, shift))
+					score.add(measureSplit(lines, shift-size))
+					if bestShift == -1 || score.compare(best) <= 0 {
+						best = score
+						bestShift = shift
+					}
+				}
+				for g.end > bestShift {
+					g.slideUp(keys, changed)
+					other.previous(otherChanged)
+				}
+			}
+		}
+		if !g.next(changed) {
+			break
+		}
+		other.next(otherChanged)
+	}
+}
+
+const (
+	maxIndent = 200
+	maxBlanks = 20
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+// splitMeasurement describes the lines around a place a group could end.
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+// indentOf counts leading whitespace with tabs to the next multiple of
+// eight. Blank lines have no indent and give -1.
+func indentOf(line string) int {
+	indent := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if !isSpace(c) {
+			return indent
+		}
+		if c == ' ' {
+			indent++
+		} else if c == '\t' {
+			indent += 8 - indent%8
+		}
+		if indent >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+func measureSplit(lines []string, split int) (m splitMeasurement) {
+	if split >= len(lines) {
+		m.endOfFile = true
+		m.indent = -1
+	} else {
+		m.indent = indentOf(lines[split])
+	}
+
+	m.preIndent = -1
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = indentOf(lines[i]); m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	m.postIndent = -1
+	for i := split + 1; i < len(lines); i++ {
+		if m.postIndent = indentOf(lines[i]); m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1 || m.preIndent == -1 || indent == m.preIndent:
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > indent:
+		if anyBlanks {
+			s.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			s.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			s.penalty += relativeDedentWithBlankPenalty
+		} else {
+			s.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+// compare is negative when s is the better split.
+func (s splitScore) compare(other splitScore) int {
+	indents := 0
+	if s.effectiveIndent > other.effectiveIndent {
+		indents = 1
+	} else if s.effectiveIndent < other.effectiveIndent {
+		indents = -1
+	}
+	return indentWeight*indents + s.penalty - other.penalty
+}
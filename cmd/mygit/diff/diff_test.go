@@ -0,0 +1,182 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// The expected hunks are what git diff --no-index prints for the same
+// files and options, from the first @@ on.
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  Options
+		old, new string
+		want     string
+	}{
+		{
+			name:    "myers with context",
+			options: Options{Context: 3},
+			old:     "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 10\n",
+			new:     "line 1\nline 2\nline 3\nline 4\nline five\nline 6\nline 7\nline 8\nline 9\nline 10\n",
+			want:    "@@ -2,7 +2,7 @@ line 1\n line 2\n line 3\n line 4\n-line 5\n+line five\n line 6\n line 7\n line 8\n",
+		},
+		{
+			name:    "myers separate hunks",
+			options: Options{Context: 3},
+			old:     "l1\nl2\nl3\nl4\nl5\nl6\nl7\nl8\nl9\nl10\nl11\nl12\nl13\nl14\nl15\nl16\nl17\nl18\nl19\nl20\n",
+			new:     "l1\nl2\nl4\nl5\nl6\nl7\nl8\nl9\nl10\nl11\nl12\nl13\nl14\nl15\nl16\nl17\nl18\nnew\nl19\nl20\n",
+			want:    "@@ -1,6 +1,5 @@\n l1\n l2\n-l3\n l4\n l5\n l6\n@@ -16,5 +15,6 @@ l15\n l16\n l17\n l18\n+new\n l19\n l20\n",
+		},
+		{
+			name:    "myers repeated lines",
+			options: Options{Context: 3},
+			old:     "a\nc\nc\n",
+			new:     "a\na\nc\n",
+			want:    "@@ -1,3 +1,3 @@\n a\n-c\n+a\n c\n",
+		},
+		{
+			name:    "histogram repeated lines",
+			options: Options{Algorithm: Histogram, Context: 3},
+			old:     "a\nc\nc\n",
+			new:     "a\na\nc\n",
+			want:    "@@ -1,3 +1,3 @@\n a\n+a\n c\n-c\n",
+		},
+		{
+			name:    "histogram anchor in common ends",
+			options: Options{Algorithm: Histogram, Context: 3},
+			old:     "\nl0\nl1\n\nl2\nl1\n",
+			new:     "\nl0\n}\nl1\n}\nl1\n\n}\nl1\n\nl2\nl1\nl2\nl1\n",
+			want:    "@@ -1,6 +1,14 @@\n \n l0\n+}\n+l1\n+}\n+l1\n+\n+}\n l1\n \n l2\n l1\n+l2\n+l1\n",
+		},
+		{
+			name:    "histogram moved block",
+			options: Options{Algorithm: Histogram, Context: 3},
+			old:     "a\nb\nc\nd\ne\nf\ng\n",
+			new:     "e\nf\na\nb\nc\nd\ng\n",
+			want:    "@@ -1,7 +1,7 @@\n+e\n+f\n a\n b\n c\n d\n-e\n-f\n g\n",
+		},
+		{
+			name:    "ignore all space",
+			options: Options{Context: 3, IgnoreAllSpace: true},
+			old:     "if (a) {\n\treturn b;\n}\n",
+			new:     "if(a){\n    return  b ;\n\treturn c;\n}\n",
+			want:    "@@ -1,3 +1,4 @@\n if(a){\n     return  b ;\n+\treturn c;\n }\n",
+		},
+		{
+			name:    "histogram ignoring all space",
+			options: Options{Algorithm: Histogram, Context: 3, IgnoreAllSpace: true},
+			old:     "if (a) {\n\treturn b;\n}\n",
+			new:     "if(a){\n    return  b ;\n\treturn c;\n}\n",
+			want:    "@@ -1,3 +1,4 @@\n if(a){\n     return  b ;\n+\treturn c;\n }\n",
+		},
+		{
+			name:    "ignore all space with only whitespace changes",
+			options: Options{Context: 3, IgnoreAllSpace: true},
+			old:     "a b\nc\n",
+			new:     "ab \n c\n",
+			want:    "",
+		},
+		{
+			name:    "ignore space change",
+			options: Options{Context: 3, IgnoreSpaceChange: true},
+			old:     "a  b\nc\t\nd e\nf\n",
+			new:     "a b\nc\nde\nf\n",
+			want:    "@@ -1,4 +1,4 @@\n a b\n c\n-d e\n+de\n f\n",
+		},
+		{
+			name:    "zero context",
+			options: Options{Context: 0},
+			old:     "a\nb\nc\nd\ne\nf\n",
+			new:     "a\nB\nc\nd\nf\ng\n",
+			want:    "@@ -2 +2 @@ a\n-b\n+B\n@@ -5 +4,0 @@ d\n-e\n@@ -6,0 +6 @@ f\n+g\n",
+		},
+		{
+			name:    "no newline at end of old file",
+			options: Options{Context: 3},
+			old:     "a\nb",
+			new:     "a\nb\nc\n",
+			want:    "@@ -1,2 +1,3 @@\n a\n-b\n\\ No newline at end of file\n+b\n+c\n",
+		},
+		{
+			name:    "no newline at end of either file",
+			options: Options{Context: 3},
+			old:     "a\nb",
+			new:     "a\nc",
+			want:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "newline removed at end of file",
+			options: Options{Context: 3},
+			old:     "a\nb\n",
+			new:     "a\nb",
+			want:    "@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Unified([]byte(test.old), []byte(test.new), test.options); got != test.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"text", "a\nb\n", false},
+		{"empty", "", false},
+		{"NUL byte", "text\x00more\n", true},
+		// git only looks at the first 8000 bytes
+		{"NUL byte past the check", strings.Repeat("x", 8000) + "\x00", false},
+		{"NUL byte at the end of the check", strings.Repeat("x", 7999) + "\x00", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsBinary([]byte(test.data)); got != test.want {
+				t.Errorf("IsBinary() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPatchBinary(t *testing.T) {
+	change := FileChange{
+		Status: Modified,
+		Old:    File{Path: "f", Mode: 100644, Hash: "9aa7c8bcc71a9ff2bfa66bc13d8874933cb0fcc1"},
+		New:    File{Path: "f", Mode: 100644, Hash: "8dbd4a69be95ab21a2936ae138f7ac00f8adb17f"},
+	}
+	// as git diff shows the change in a repository
+	want := "diff --git a/f b/f\nindex 9aa7c8b..8dbd4a6 100644\nBinary files a/f and b/f differ\n"
+	if got := Patch(change, []byte("text\x00more\n"), []byte("text\x00other\n"), DefaultOptions()); got != want {
+		t.Errorf("Patch() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// A change that is only whitespace leaves nothing to show with -w, unless
+// the mode changed too. The expected output is git diff -w's.
+func TestPatchIgnoredWhitespace(t *testing.T) {
+	old := File{Path: "f", Mode: 100644, Hash: "b2901ea97cfc0f297529eb23d489eab8cb71f9db"}
+	tests := []struct {
+		name string
+		mode int
+		want string
+	}{
+		{"same mode", 100644, ""},
+		{"mode change", 100755, "diff --git a/f b/f\nold mode 100644\nnew mode 100755\nindex b2901ea..5986e6e\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			change := FileChange{Status: Modified, Old: old, New: File{Path: "f", Mode: test.mode, Hash: "5986e6e7749561cc808e046e20e811b3507897e0"}}
+			options := DefaultOptions()
+			options.IgnoreAllSpace = true
+			if got := Patch(change, []byte("a b\n"), []byte("a  b\n"), options); got != test.want {
+				t.Errorf("Patch() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
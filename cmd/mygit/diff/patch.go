@@ -0,0 +1,509 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// File is one side of a changed path.
+type File struct {
+	Path string
+	// Mode is the octal mode written out as decimal digits, like in trees.
+	Mode int
+	Hash string
+}
+
+type Status byte
+
+const (
+	Added       Status = 'A'
+	Deleted     Status = 'D'
+	Modified    Status = 'M'
+	TypeChanged Status = 'T'
+	Renamed     Status = 'R'
+	Copied      Status = 'C'
+	Unmerged    Status = 'U'
+)
+
+// FileChange is a path that differs between two snapshots. Old is empty for
+// an added file and New for a deleted one.
+type FileChange struct {
+	Status Status
+	Old    File
+	New    File
+	// Similarity is the percentage of a rename or copy's content that
+	// came from the old file.
+	Similarity int
+}
+
+// StatusString is the status as diff-tree and --name-status show it, with
+// the similarity for renames and copies: "M", "R086".
+func (c FileChange) StatusString() string {
+	if c.Status == Renamed || c.Status == Copied {
+		return fmt.Sprintf("%c%03d", c.Status, c.Similarity)
+	}
+	return string(c.Status)
+}
+
+// Paths lists the paths of a change the way --name-status shows them: both
+// for a rename or copy, otherwise just the one.
+func (c FileChange) Paths() []string {
+	if c.Status == Renamed || c.Status == Copied {
+		return []string{c.Old.Path, c.New.Path}
+	}
+	return []string{c.Path()}
+}
+
+// Path is the name the change is listed under.
+func (c FileChange) Path() string {
+	if c.Status == Deleted {
+		return c.Old.Path
+	}
+	return c.New.Path
+}
+
+// Compare lists the paths that differ between two snapshots keyed by path,
+// sorted by path.
+func Compare(oldFiles map[string]File, newFiles map[string]File) []FileChange {
+	changes := []FileChange{}
+	for path, oldFile := range oldFiles {
+		newFile, found := newFiles[path]
+		switch {
+		case !found:
+			changes = append(changes, FileChange{Status: Deleted, Old: oldFile})
+		case fileType(oldFile.Mode) != fileType(newFile.Mode):
+			changes = append(changes, FileChange{Status: TypeChanged, Old: oldFile, New: newFile})
+		case oldFile.Hash != newFile.Hash || oldFile.Mode != newFile.Mode:
+			changes = append(changes, FileChange{Status: Modified, Old: oldFile, New: newFile})
+		}
+	}
+	for path, newFile := range newFiles {
+		if _, found := oldFiles[path]; !found {
+			changes = append(changes, FileChange{Status: Added, New: newFile})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path() < changes[j].Path() })
+	return changes
+}
+
+// fileType tells regular files (10), symlinks (12) and gitlinks (16) apart.
+func fileType(mode int) int {
+	return mode / 10000
+}
+
+// Raw formats a change as a line of diff-tree's default output: both
+// modes and hashes, the status and the paths.
+func Raw(change FileChange) string {
+	oldHash, newHash := change.Old.Hash, change.New.Hash
+	if oldHash == "" {
+		oldHash = zeroHash
+	}
+	if newHash == "" {
+		newHash = zeroHash
+	}
+	return fmt.Sprintf(":%06d %06d %s %s %s\t%s", change.Old.Mode, change.New.Mode, oldHash, newHash, change.StatusString(), strings.Join(change.Paths(), "\t"))
+}
+
+const (
+	zeroHash     = "0000000000000000000000000000000000000000"
+	abbrevLength = 7
+)
+
+// palette holds the escape codes git uses for colored diffs, or nothing at
+// all when color is off.
+type palette struct {
+	meta, fragment, old, new, whitespace, reset string
+}
+
+func colors(enabled bool) palette {
+	if !enabled {
+		return palette{}
+	}
+	return palette{
+		meta:       "\x1b[1m",
+		fragment:   "\x1b[36m",
+		old:        "\x1b[31m",
+		new:        "\x1b[32m",
+		whitespace: "\x1b[41m",
+		reset:      "\x1b[m",
+	}
+}
+
+// Patch formats a change the way git diff does: the diff --git header, mode
+// and index lines, then the hunks. A type change is shown as a deletion
+// followed by an addition.
+func Patch(change FileChange, oldData []byte, newData []byte, options Options) string {
+	if change.Status == TypeChanged {
+		return Patch(FileChange{Status: Deleted, Old: change.Old}, oldData, nil, options) +
+			Patch(FileChange{Status: Added, New: change.New}, nil, newData, options)
+	}
+	colors := colors(options.Color)
+
+	oldName, newName := "a/"+change.Old.Path, "b/"+change.New.Path
+	header := []string{}
+	switch change.Status {
+	case Added:
+		oldName = "/dev/null"
+		header = append(header,
+			fmt.Sprintf("diff --git a/%s b/%s", change.New.Path, change.New.Path),
+			fmt.Sprintf("new file mode %06d", change.New.Mode),
+			fmt.Sprintf("index %s..%s", abbreviate(zeroHash), abbreviate(change.New.Hash)))
+	case Deleted:
+		newName = "/dev/null"
+		header = append(header,
+			fmt.Sprintf("diff --git a/%s b/%s", change.Old.Path, change.Old.Path),
+			fmt.Sprintf("deleted file mode %06d", change.Old.Mode),
+			fmt.Sprintf("index %s..%s", abbreviate(change.Old.Hash), abbreviate(zeroHash)))
+	default:
+		header = append(header, fmt.Sprintf("diff --git a/%s b/%s", change.Old.Path, change.New.Path))
+		if change.Old.Mode != change.New.Mode {
+			header = append(header,
+				fmt.Sprintf("old mode %06d", change.Old.Mode),
+				fmt.Sprintf("new mode %06d", change.New.Mode))
+		}
+		switch change.Status {
+		case Renamed:
+			header = append(header,
+				fmt.Sprintf("similarity index %d%%", change.Similarity),
+				"rename from "+change.Old.Path,
+				"rename to "+change.New.Path)
+		case Copied:
+			header = append(header,
+				fmt.Sprintf("similarity index %d%%", change.Similarity),
+				"copy from "+change.Old.Path,
+				"copy to "+change.New.Path)
+		}
+		if change.Old.Hash != change.New.Hash {
+			index := fmt.Sprintf("index %s..%s", abbreviate(change.Old.Hash), abbreviate(change.New.Hash))
+			if change.Old.Mode == change.New.Mode {
+				index += fmt.Sprintf(" %06d", change.New.Mode)
+			}
+			header = append(header, index)
+		}
+	}
+
+	var result strings.Builder
+	for _, line := range header {
+		result.WriteString(colors.meta + line + colors.reset + "\n")
+	}
+	if change.Old.Hash == change.New.Hash {
+		return result.String()
+	}
+	if IsBinary(oldData) || IsBinary(newData) {
+		result.WriteString(fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName))
+		return result.String()
+	}
+
+	a, b := Lines(oldData), Lines(newData)
+	hunks := Hunks(a, b, options)
+	if len(hunks) == 0 {
+		// with whitespace ignored a change can come down to nothing, and
+		// then git leaves the file out unless the header says more
+		if change.Status == Modified && change.Old.Mode == change.New.Mode {
+			return ""
+		}
+		return result.String()
+	}
+	result.WriteString(colors.meta + "--- " + oldName + colors.reset + "\n")
+	result.WriteString(colors.meta + "+++ " + newName + colors.reset + "\n")
+
+	blankPreimage, blankPostimage := blankAtEOF(oldData, newData)
+	for _, hunk := range hunks {
+		result.WriteString(colors.fragment + "@@ -" + hunkRange(hunk.OldStart, hunk.OldCount) + " +" + hunkRange(hunk.NewStart, hunk.NewCount) + " @@" + colors.reset)
+		if hunk.Function != "" {
+			result.WriteString(" " + colors.reset + hunk.Function + colors.reset)
+		}
+		result.WriteString("\n")
+
+		// line numbers are tracked the way git does to spot blank lines
+		// added at the end of the file
+		preimage, postimage := hunkStart(hunk.OldStart, hunk.OldCount), hunkStart(hunk.NewStart, hunk.NewCount)
+		for _, line := range hunk.Lines {
+			text, complete := strings.CutSuffix(line.Text, "\n")
+			switch line.Op {
+			case ' ':
+				preimage++
+				postimage++
+				result.WriteString(" " + text + colors.reset)
+			case '-':
+				preimage++
+				result.WriteString(colors.old + "-" + text + colors.reset)
+			case '+':
+				postimage++
+				if blankPreimage > 0 && blankPreimage <= preimage && blankPostimage <= postimage && isBlank(text) {
+					result.WriteString(colors.whitespace + "+" + text + colors.reset)
+				} else {
+					result.WriteString(colors.new + "+" + colors.reset + colors.highlightWhitespace(text))
+				}
+			}
+			result.WriteString("\n")
+			if !complete {
+				result.WriteString("\\ No newline at end of file" + colors.reset + "\n")
+			}
+		}
+	}
+	return result.String()
+}
+
+func abbreviate(hash string) string {
+	return hash[:min(abbrevLength, len(hash))]
+}
+
+// hunkStart is the line number shown in a hunk header.
+func hunkStart(start int, count int) int {
+	if count == 0 {
+		return start
+	}
+	return start + 1
+}
+
+// highlightWhitespace colors an added line, marking trailing whitespace and
+// spaces before a tab in the indent as errors, like git's default
+// core.whitespace.
+func (p palette) highlightWhitespace(line string) string {
+	var result strings.Builder
+	trailing := len(line)
+	for i := len(line) - 1; i >= 0 && isSpace(line[i]); i-- {
+		trailing = i
+	}
+
+	written := 0
+	for i := 0; i < trailing; i++ {
+		if line[i] == ' ' {
+			continue
+		}
+		if line[i] != '\t' {
+			break
+		}
+		if written < i {
+			result.WriteString(p.whitespace + line[written:i] + p.reset + "\t")
+		} else {
+			result.WriteString(line[written : i+1])
+		}
+		written = i + 1
+	}
+	if trailing > written {
+		result.WriteString(p.new + line[written:trailing] + p.reset)
+	}
+	if trailing < len(line) {
+		result.WriteString(p.whitespace + line[trailing:] + p.reset)
+	}
+	return result.String()
+}
+
+// blankAtEOF returns the line numbers where the runs of blank lines at the
+// end of each file start, or zeros when the new file doesn't end with more
+// of them than the old one.
+func blankAtEOF(oldData []byte, newData []byte) (preimage int, postimage int) {
+	oldBlank, newBlank := trailingBlankLines(oldData), trailingBlankLines(newData)
+	if newBlank <= oldBlank {
+		return 0, 0
+	}
+	return len(Lines(oldData)) - oldBlank + 1, len(Lines(newData)) - newBlank + 1
+}
+
+// trailingBlankLines counts the whitespace-only lines at the end of data.
+// Like git, it never counts the first line.
+func trailingBlankLines(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	end := len(data) - 1
+	if data[end] == '\n' {
+		end--
+	}
+	count := 0
+	for end > 0 {
+		start := end
+		for start >= 0 && data[start] != '\n' {
+			start--
+		}
+		if !isBlank(string(data[start+1 : end+1])) {
+			break
+		}
+		count++
+		end = start - 1
+	}
+	return count
+}
+
+func isBlank(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if !isSpace(line[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of lines added and deleted between two contents.
+func Count(oldData []byte, newData []byte, options Options) (added int, deleted int) {
+	for _, change := range Changes(Lines(oldData), Lines(newData), options) {
+		added += change.NewEnd - change.NewStart
+		deleted += change.OldEnd - change.OldStart
+	}
+	return added, deleted
+}
+
+// FileStat is one line of a diffstat.
+type FileStat struct {
+	Name    string
+	Added   int
+	Deleted int
+	// Binary files show their sizes instead of line counts.
+	Binary  bool
+	OldSize int
+	NewSize int
+}
+
+// Stat formats a diffstat fitting in width columns, with the summary line
+// at the end. Names and the graph are shortened to fit like git does.
+func Stat(files []FileStat, width int, color bool) string {
+	colors := colors(color)
+	maxName, maxChange, numberWidth, binaryWidth := 0, 0, 0, 0
+	for _, file := range files {
+		maxName = max(maxName, len(file.Name))
+		if file.Binary {
+			binaryWidth = max(binaryWidth, 14+decimalWidth(file.OldSize)+decimalWidth(file.NewSize))
+			numberWidth = 3
+			continue
+		}
+		maxChange = max(maxChange, file.Added+file.Deleted)
+	}
+
+	numberWidth = max(numberWidth, decimalWidth(maxChange))
+	width = max(width, 16+6+numberWidth)
+	graphWidth := maxChange
+	if maxChange+4 <= binaryWidth {
+		graphWidth = binaryWidth - 4
+	}
+	nameWidth := maxName
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	var result strings.Builder
+	insertions, deletions := 0, 0
+	for _, file := range files {
+		name, prefix := file.Name, ""
+		if len(name) > nameWidth {
+			// keep the end of the name, starting at a directory if possible
+			prefix = "..."
+			name = name[len(name)-max(nameWidth-3, 0):]
+			if slash := strings.Index(name, "/"); slash >= 0 {
+				name = name[slash:]
+			}
+		}
+		padding := max(nameWidth-len(prefix)-len(name), 0)
+		result.WriteString(" " + prefix + name + strings.Repeat(" ", padding) + " |")
+
+		if file.Binary {
+			result.WriteString(fmt.Sprintf(" %*s", numberWidth, "Bin"))
+			if file.OldSize != 0 || file.NewSize != 0 {
+				result.WriteString(fmt.Sprintf(" %s%d%s -> %s%d%s bytes", colors.old, file.OldSize, colors.reset, colors.new, file.NewSize, colors.reset))
+			}
+			result.WriteString("\n")
+			continue
+		}
+
+		insertions += file.Added
+		deletions += file.Deleted
+		added, deleted := file.Added, file.Deleted
+		result.WriteString(fmt.Sprintf(" %*d", numberWidth, added+deleted))
+		if added+deleted > 0 {
+			result.WriteString(" ")
+		}
+		if graphWidth <= maxChange {
+			total := scaleLinear(added+deleted, graphWidth, maxChange)
+			if total < 2 && added > 0 && deleted > 0 {
+				total = 2
+			}
+			if added < deleted {
+				added = scaleLinear(added, graphWidth, maxChange)
+				deleted = total - added
+			} else {
+				deleted = scaleLinear(deleted, graphWidth, maxChange)
+				added = total - deleted
+			}
+		}
+		if added > 0 {
+			result.WriteString(colors.new + strings.Repeat("+", added) + colors.reset)
+		}
+		if deleted > 0 {
+			result.WriteString(colors.old + strings.Repeat("-", deleted) + colors.reset)
+		}
+		result.WriteString("\n")
+	}
+	result.WriteString(StatSummary(len(files), insertions, deletions) + "\n")
+	return result.String()
+}
+
+// scaleLinear shrinks a count to the graph's width, always keeping at least
+// one column for a nonzero count.
+func scaleLinear(count int, width int, maxChange int) int {
+	if count == 0 {
+		return 0
+	}
+	return 1 + count*(width-1)/maxChange
+}
+
+func decimalWidth(n int) int {
+	return len(fmt.Sprint(n))
+}
+
+// Summary describes what a change did to a file beyond its content, as
+// --summary shows: files created, deleted, renamed or copied, and mode
+// changes. It is empty for a plain modification.
+func Summary(change FileChange) string {
+	modeChange := func(showName bool) string {
+		if change.Old.Mode == 0 || change.New.Mode == 0 || change.Old.Mode == change.New.Mode {
+			return ""
+		}
+		line := fmt.Sprintf(" mode change %06d => %06d", change.Old.Mode, change.New.Mode)
+		if showName {
+			line += " " + change.New.Path
+		}
+		return line + "\n"
+	}
+	switch change.Status {
+	case Added:
+		return fmt.Sprintf(" create mode %06d %s\n", change.New.Mode, change.New.Path)
+	case Deleted:
+		return fmt.Sprintf(" delete mode %06d %s\n", change.Old.Mode, change.Old.Path)
+	case Renamed:
+		return fmt.Sprintf(" rename %s (%d%%)\n", RenameName(change.Old.Path, change.New.Path), change.Similarity) + modeChange(false)
+	case Copied:
+		return fmt.Sprintf(" copy %s (%d%%)\n", RenameName(change.Old.Path, change.New.Path), change.Similarity) + modeChange(false)
+	}
+	return modeChange(true)
+}
+
+// StatSummary is the closing line of a diffstat.
+func StatSummary(files int, insertions int, deletions int) string {
+	if files == 0 {
+		return " 0 files changed"
+	}
+	summary := fmt.Sprintf(" %d %s changed", files, plural(files, "file", "files"))
+	if insertions > 0 || deletions == 0 {
+		summary += fmt.Sprintf(", %d %s(+)", insertions, plural(insertions, "insertion", "insertions"))
+	}
+	if deletions > 0 || insertions == 0 {
+		summary += fmt.Sprintf(", %d %s(-)", deletions, plural(deletions, "deletion", "deletions"))
+	}
+	return summary
+}
+
+func plural(n int, one string, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,364 @@
+package diff
+
+import (
+	"path"
+	"sort"
+)
+
+const (
+	// MaxScore is the similarity of identical files. Scores are kept in
+	// these units and shown as percentages.
+	MaxScore = 60000
+	// DefaultMinimumScore is the 50% similarity git asks of a rename.
+	DefaultMinimumScore = MaxScore / 2
+
+	// candidatesPerDestination bounds how many sources are remembered for
+	// each new file while scoring.
+	candidatesPerDestination = 4
+	// renameLimit skips content comparisons when there would be more than
+	// its square of them, like diff.renameLimit.
+	renameLimit = 1000
+)
+
+// RenameOptions control rename and copy detection.
+type RenameOptions struct {
+	// MinimumScore is how similar, out of MaxScore, two files have to be to
+	// pair them up.
+	MinimumScore int
+	// Copies also looks for new files copied from files that were modified
+	// (-C).
+	Copies bool
+	// Unchanged are files that are the same on both sides. They are
+	// considered as copy sources too (--find-copies-harder).
+	Unchanged []File
+}
+
+// DefaultRenameOptions detect renames at git's default threshold.
+func DefaultRenameOptions() RenameOptions {
+	return RenameOptions{MinimumScore: DefaultMinimumScore}
+}
+
+// ParseScore reads a similarity threshold the way -M and -C take it: a
+// percentage when followed by '%', or otherwise the digits of a fraction,
+// so "5" and "50%" both mean half.
+func ParseScore(value string) int {
+	number, scale, dot := 0, 1, false
+	for _, c := range value {
+		if c == '.' && !dot {
+			scale, dot = 1, true
+		} else if c == '%' {
+			if dot {
+				scale *= 100
+			} else {
+				scale = 100
+			}
+			break
+		} else if c >= '0' && c <= '9' {
+			if scale < 100000 {
+				scale *= 10
+				number = number*10 + int(c-'0')
+			}
+		} else {
+			break
+		}
+	}
+	if number >= scale {
+		return MaxScore
+	}
+	return MaxScore * number / scale
+}
+
+type renameSource struct {
+	file    File
+	deleted bool
+	used    int
+}
+
+type renameDestination struct {
+	change int
+	file   File
+	source int
+	score  int
+}
+
+type scoredPair struct {
+	destination int
+	source      int
+	score       int
+	sameName    bool
+}
+
+// DetectRenames pairs added files with deleted ones they are similar enough
+// to, turning them into renames, and with Copies also with modified or
+// unchanged ones, turning them into copies. Identical files are paired
+// first. A deleted file that several new files came from is a copy for all
+// but the last of them. readOld and readNew load the content of each side.
+func DetectRenames(changes []FileChange, options RenameOptions, readOld func(File) ([]byte, error), readNew func(File) ([]byte, error)) (result []FileChange, err error) {
+	sources := []*renameSource{}
+	destinations := []*renameDestination{}
+	for i, change := range changes {
+		switch {
+		case change.Old.Mode == 40000 || change.New.Mode == 40000:
+			// subtrees listed without recursing are never paired
+		case change.Status == Added:
+			destinations = append(destinations, &renameDestination{change: i, file: change.New, source: -1})
+		case change.Status == Deleted:
+			sources = append(sources, &renameSource{file: change.Old, deleted: true})
+		case options.Copies && (change.Status == Modified || change.Status == TypeChanged):
+			sources = append(sources, &renameSource{file: change.Old})
+		}
+	}
+	if options.Copies {
+		for _, file := range options.Unchanged {
+			sources = append(sources, &renameSource{file: file})
+		}
+	}
+	if len(sources) == 0 || len(destinations) == 0 {
+		return changes, nil
+	}
+
+	// identical content first, preferring sources nothing was paired with
+	// yet and then ones with the same file name
+	for _, destination := range destinations {
+		best, bestScore := -1, -1
+		for j, source := range sources {
+			if source.file.Hash != destination.file.Hash || fileType(source.file.Mode) != fileType(destination.file.Mode) {
+				continue
+			}
+			if source.used > 0 && !options.Copies {
+				continue
+			}
+			score := 0
+			if source.used == 0 {
+				score++
+			}
+			if sameName(source.file, destination.file) {
+				score++
+			}
+			if score > bestScore {
+				best, bestScore = j, score
+			}
+		}
+		if best >= 0 {
+			destination.source, destination.score = best, MaxScore
+			sources[best].used++
+		}
+	}
+
+	remaining := []int{}
+	for i, destination := range destinations {
+		if destination.source < 0 && fileType(destination.file.Mode) == fileType(100644) {
+			remaining = append(remaining, i)
+		}
+	}
+	if len(remaining) > 0 && len(remaining)*len(sources) <= renameLimit*renameLimit {
+		if err := matchSimilar(sources, destinations, remaining, options, readOld, readNew); err != nil {
+			return nil, err
+		}
+	}
+
+	renamed := make([]bool, len(sources))
+	for _, destination := range destinations {
+		if destination.source >= 0 {
+			renamed[destination.source] = true
+		}
+	}
+	byChange := map[int]*renameDestination{}
+	for _, destination := range destinations {
+		byChange[destination.change] = destination
+	}
+
+	result = []FileChange{}
+	for i, change := range changes {
+		if change.Status == Deleted && isRenameSource(sources, renamed, change.Old) {
+			continue
+		}
+		destination, found := byChange[i]
+		if !found || destination.source < 0 {
+			result = append(result, change)
+			continue
+		}
+		source := sources[destination.source]
+		paired := FileChange{Status: Copied, Old: source.file, New: destination.file, Similarity: destination.score * 100 / MaxScore}
+		if source.deleted {
+			source.used--
+			if source.used == 0 {
+				paired.Status = Renamed
+			}
+		}
+		result = append(result, paired)
+	}
+	return result, nil
+}
+
+// matchSimilar scores the unpaired new files against every source, keeping
+// the best few candidates for each, and pairs them from the most similar
+// down. Renames are settled before copies.
+func matchSimilar(sources []*renameSource, destinations []*renameDestination, remaining []int, options RenameOptions, readOld func(File) ([]byte, error), readNew func(File) ([]byte, error)) (err error) {
+	sourceChunks := make([]map[uint32]int, len(sources))
+	sourceSizes := make([]int, len(sources))
+	for j, source := range sources {
+		if fileType(source.file.Mode) != fileType(100644) {
+			continue
+		}
+		data, err := readOld(source.file)
+		if err != nil {
+			return err
+		}
+		sourceChunks[j], sourceSizes[j] = chunks(data), len(data)
+	}
+
+	candidates := []scoredPair{}
+	for _, i := range remaining {
+		destination := destinations[i]
+		data, err := readNew(destination.file)
+		if err != nil {
+			return err
+		}
+		destinationChunks := chunks(data)
+
+		best := []scoredPair{}
+		for j, source := range sources {
+			if sourceChunks[j] == nil || (source.used > 0 && !options.Copies) {
+				continue
+			}
+			pair := scoredPair{
+				destination: i,
+				source:      j,
+				score:       similarity(sourceChunks[j], sourceSizes[j], destinationChunks, len(data), options.MinimumScore),
+				sameName:    sameName(source.file, destination.file),
+			}
+			best = append(best, pair)
+			sort.SliceStable(best, func(a, b int) bool { return betterPair(best[a], best[b]) })
+			if len(best) > candidatesPerDestination {
+				best = best[:candidatesPerDestination]
+			}
+		}
+		candidates = append(candidates, best...)
+	}
+	sort.SliceStable(candidates, func(a, b int) bool { return betterPair(candidates[a], candidates[b]) })
+
+	for _, copies := range []bool{false, true} {
+		if copies && !options.Copies {
+			break
+		}
+		for _, pair := range candidates {
+			if pair.score < options.MinimumScore {
+				break
+			}
+			destination := destinations[pair.destination]
+			if destination.source >= 0 || (!copies && sources[pair.source].used > 0) {
+				continue
+			}
+			destination.source, destination.score = pair.source, pair.score
+			sources[pair.source].used++
+		}
+	}
+	return nil
+}
+
+func betterPair(a scoredPair, b scoredPair) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.sameName && !b.sameName
+}
+
+func sameName(a File, b File) bool {
+	return path.Base(a.Path) == path.Base(b.Path)
+}
+
+func isRenameSource(sources []*renameSource, renamed []bool, file File) bool {
+	for j, source := range sources {
+		if renamed[j] && source.deleted && source.file.Path == file.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkHashBase is the number of buckets content chunks are hashed into.
+const chunkHashBase = 107927
+
+// chunks splits data into lines, or 64 byte pieces of long lines, and
+// counts how many bytes land in each hash bucket. Comparing the counts is
+// how git estimates how much of one file was carried over into another.
+func chunks(data []byte) map[uint32]int {
+	counts := map[uint32]int{}
+	text := !IsBinary(data)
+	length := 0
+	var accumulator1, accumulator2 uint32
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		// a CR in a CRLF pair doesn't count for text
+		if text && c == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			continue
+		}
+		previous := accumulator1
+		accumulator1 = (accumulator1 << 7) ^ (accumulator2 >> 25)
+		accumulator2 = (accumulator2 << 7) ^ (previous >> 25)
+		accumulator1 += uint32(c)
+		length++
+		if length < 64 && c != '\n' {
+			continue
+		}
+		counts[(accumulator1+accumulator2*0x61)%chunkHashBase] += length
+		length, accumulator1, accumulator2 = 0, 0, 0
+	}
+	if length > 0 {
+		counts[(accumulator1+accumulator2*0x61)%chunkHashBase] += length
+	}
+	return counts
+}
+
+// similarity scores how much of the larger file is made of content the
+// source also has. Pairs whose sizes differ too much to reach minimumScore
+// score zero without comparing.
+func similarity(sourceChunks map[uint32]int, sourceSize int, destinationChunks map[uint32]int, destinationSize int, minimumScore int) int {
+	maxSize, baseSize := max(sourceSize, destinationSize), min(sourceSize, destinationSize)
+	if maxSize == 0 || maxSize*(MaxScore-minimumScore) < (maxSize-baseSize)*MaxScore {
+		return 0
+	}
+	copied := 0
+	for hash, count := range destinationChunks {
+		copied += min(count, sourceChunks[hash])
+	}
+	return copied * MaxScore / maxSize
+}
+
+// RenameName shows a rename the way diffstat does, with the common leading
+// directories and trailing part outside of braces: "dir/{old => new}.c".
+func RenameName(oldPath string, newPath string) string {
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+
+	prefix := 0
+	for i := 0; i < len(oldPath) && i < len(newPath) && oldPath[i] == newPath[i]; i++ {
+		if oldPath[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// the suffix may run back into the prefix's final slash, but no further
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	for i, j := len(oldPath), len(newPath); prefix-adjust <= i && prefix-adjust <= j && at(oldPath, i) == at(newPath, j); i, j = i-1, j-1 {
+		if at(oldPath, i) == '/' {
+			suffix = len(oldPath) - i
+		}
+	}
+
+	oldMiddle := max(len(oldPath)-prefix-suffix, 0)
+	newMiddle := max(len(newPath)-prefix-suffix, 0)
+	if prefix+suffix == 0 {
+		return oldPath + " => " + newPath
+	}
+	return oldPath[:prefix] + "{" + oldPath[prefix:prefix+oldMiddle] + " => " + newPath[prefix:prefix+newMiddle] + "}" + oldPath[len(oldPath)-suffix:]
+}
@@ -0,0 +1,169 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+)
+
+// TreeOptions control how far Trees descends and what it reports.
+type TreeOptions struct {
+	// Recursive descends into subtrees instead of reporting them as changed
+	// entries (-r).
+	Recursive bool
+	// ShowTrees also reports the subtrees Recursive descends into (-t).
+	ShowTrees bool
+	// Paths limits the comparison to these paths and what is below them.
+	Paths []string
+}
+
+// Trees compares two trees by walking them side by side. Subtrees with the
+// same hash are skipped without being read. An empty hash stands for the
+// empty tree.
+func Trees(oldTree string, newTree string, options TreeOptions) (changes []FileChange, err error) {
+	changes = []FileChange{}
+	err = compareTrees(oldTree, newTree, "", options, &changes)
+	return changes, err
+}
+
+func compareTrees(oldTree string, newTree string, prefix string, options TreeOptions, changes *[]FileChange) (err error) {
+	if oldTree == newTree {
+		return nil
+	}
+	oldEntries, err := sortedTree(oldTree)
+	if err != nil {
+		return err
+	}
+	newEntries, err := sortedTree(newTree)
+	if err != nil {
+		return err
+	}
+
+	for i, j := 0, 0; i < len(oldEntries) || j < len(newEntries); {
+		var oldEntry, newEntry *gitobject.TreeNode
+		switch {
+		case j == len(newEntries):
+			oldEntry = &oldEntries[i]
+		case i == len(oldEntries):
+			newEntry = &newEntries[j]
+		default:
+			switch compare := strings.Compare(entryKey(oldEntries[i]), entryKey(newEntries[j])); {
+			case compare < 0:
+				oldEntry = &oldEntries[i]
+			case compare > 0:
+				newEntry = &newEntries[j]
+			default:
+				oldEntry, newEntry = &oldEntries[i], &newEntries[j]
+			}
+		}
+		if oldEntry != nil {
+			i++
+		}
+		if newEntry != nil {
+			j++
+		}
+
+		var name string
+		if oldEntry != nil {
+			name = prefix + oldEntry.Name
+		} else {
+			name = prefix + newEntry.Name
+		}
+		isTree := (oldEntry != nil && oldEntry.Mode == 40000) || (newEntry != nil && newEntry.Mode == 40000)
+		if !matchesPathspecOrParent(name, isTree, options.Paths) {
+			continue
+		}
+		if oldEntry != nil && newEntry != nil && oldEntry.Hash == newEntry.Hash && oldEntry.Mode == newEntry.Mode {
+			continue
+		}
+
+		change := FileChange{Status: Modified}
+		switch {
+		case newEntry == nil:
+			change.Status = Deleted
+			change.Old = File{Path: name, Mode: oldEntry.Mode, Hash: oldEntry.Hash}
+		case oldEntry == nil:
+			change.Status = Added
+			change.New = File{Path: name, Mode: newEntry.Mode, Hash: newEntry.Hash}
+		default:
+			change.Old = File{Path: name, Mode: oldEntry.Mode, Hash: oldEntry.Hash}
+			change.New = File{Path: name, Mode: newEntry.Mode, Hash: newEntry.Hash}
+			if fileType(oldEntry.Mode) != fileType(newEntry.Mode) {
+				change.Status = TypeChanged
+			}
+		}
+
+		if !isTree || !options.Recursive {
+			*changes = append(*changes, change)
+			continue
+		}
+		if options.ShowTrees {
+			*changes = append(*changes, change)
+		}
+		if err := compareTrees(change.Old.Hash, change.New.Hash, name+"/", options, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedTree reads a tree's entries in git's order, where a subtree sorts
+// as if its name ended in a slash. Trees git writes are already in that
+// order; sorting again keeps the walk right for any that aren't.
+func sortedTree(hash string) (entries []gitobject.TreeNode, err error) {
+	if hash == "" {
+		return nil, nil
+	}
+	objectType, data, err := gitobject.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != "tree" {
+		return nil, fmt.Errorf("%s is not a tree", hash)
+	}
+	entries = gitobject.ReadTree(len(data), bytes.NewReader(data))
+	sort.SliceStable(entries, func(i, j int) bool { return entryKey(entries[i]) < entryKey(entries[j]) })
+	return entries, nil
+}
+
+func entryKey(node gitobject.TreeNode) string {
+	if node.Mode == 40000 {
+		return node.Name + "/"
+	}
+	return node.Name
+}
+
+// MatchesPathspec reports whether path is one of paths or inside one of
+// them. No paths match everything.
+func MatchesPathspec(path string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, pathspec := range paths {
+		pathspec = strings.TrimSuffix(pathspec, "/")
+		if pathspec == "." || pathspec == path || strings.HasPrefix(path, pathspec+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPathspecOrParent also accepts a directory that a path in paths is
+// below, since the walk has to go through it.
+func matchesPathspecOrParent(path string, isTree bool, paths []string) bool {
+	if MatchesPathspec(path, paths) {
+		return true
+	}
+	if !isTree {
+		return false
+	}
+	for _, pathspec := range paths {
+		if strings.HasPrefix(pathspec, path+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,33 +1,32 @@
 package git
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
-	"github.com/codecrafters-io/git-starter-go/cmd/mygit/readerutils"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
 )
 
-func Initialize(createMainBranch bool) (err error) {
+// Initialize creates the .git directory with HEAD on initialBranch, which
+// doesn't need to exist yet.
+func Initialize(initialBranch string) (err error) {
 	for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("error creating directory: %s", err)
 		}
 	}
 
-	if createMainBranch {
-		headFileContents := []byte("ref: refs/heads/main\n")
-		if err := os.WriteFile(".git/HEAD", headFileContents, 0644); err != nil {
-			return fmt.Errorf("error writing file: %s", err)
-		}
+	if initialBranch != "" {
+		return refs.WriteSymbolic("HEAD", "refs/heads/"+initialBranch, "")
 	}
 	return nil
 }
 
-func MakeBranch(ref string, hash string) (err error) {
+func MakeBranch(ref string, hash string, message string) (err error) {
 	objectType, err := gitobject.Type(hash)
 	if err != nil {
 		return err
@@ -36,80 +35,97 @@ func MakeBranch(ref string, hash string) (err error) {
 		return fmt.Errorf("%s isn't a commit and so can't be made a branch", hash)
 	}
 
-	if err := os.MkdirAll(".git/refs/heads", 0755); err != nil {
-		return err
-	}
-
-	if err := os.WriteFile(fmt.Sprintf(".git/refs/heads/%s", ref), []byte(hash+"\n"), 0644); err != nil {
+	fullHash, err := gitobject.FullHash(hash)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	return refs.Write("refs/heads/"+ref, fullHash, message)
 }
 
+// Checkout switches HEAD to the branch ref and moves the working tree and
+// index over to its commit.
 func Checkout(ref string) (err error) {
-	hash, err := os.ReadFile(fmt.Sprintf(".git/refs/heads/%s", ref))
+	stringHash, err := refs.Read("refs/heads/" + ref)
 	if err != nil {
 		return err
 	}
-	stringHash := string(hash[:len(hash)-1]) // remove trailing \n
+	if err := CheckoutCommit(stringHash); err != nil {
+		return err
+	}
 
-	headFileContents := []byte(fmt.Sprintf("ref: refs/heads/%s\n", ref))
-	if err := os.WriteFile(".git/HEAD", headFileContents, 0644); err != nil {
-		return fmt.Errorf("error writing file: %s", err)
+	if current, err := refs.ReadSymbolic("HEAD"); err != nil || current != "refs/heads/"+ref {
+		message := fmt.Sprintf("checkout: moving from %s to %s", describeHead(), ref)
+		if err := refs.WriteSymbolic("HEAD", "refs/heads/"+ref, message); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	commitReader, err := gitobject.Reader(stringHash)
-	if err != nil {
+// CheckoutDetached points HEAD directly at a commit and moves the working
+// tree and index over to it.
+func CheckoutDetached(hash string) (err error) {
+	if objectType, err := gitobject.Type(hash); err != nil {
+		return err
+	} else if objectType != "commit" {
+		return fmt.Errorf("%s isn't a commit and so can't be checked out", hash)
+	}
+	if err := CheckoutCommit(hash); err != nil {
 		return err
 	}
-	readerutils.ReadToNextNullByte(commitReader)
-	readerutils.ReadNBytes(5, commitReader) // 'tree '
-	treeHash := string(readerutils.ReadNBytes(20, commitReader))
-	commitReader.Close()
-	return constructTree("./", treeHash)
+
+	transaction := refs.NewTransaction()
+	transaction.UpdateNoDeref("HEAD", hash, "", fmt.Sprintf("checkout: moving from %s to %s", describeHead(), hash))
+	return transaction.Commit()
 }
 
-func constructTree(path string, hash string) (err error) {
-	treeReader, err := gitobject.Reader(hash)
-	if err != nil {
-		return err
+// describeHead names what HEAD is on for reflog messages: the branch name, or
+// the commit when detached.
+func describeHead() string {
+	if target, err := refs.ReadSymbolic("HEAD"); err == nil {
+		return strings.TrimPrefix(target, "refs/heads/")
 	}
-	defer treeReader.Close()
+	hash, _ := refs.Read("HEAD")
+	return hash
+}
 
-	length, err := strconv.Atoi(strings.Split(string(readerutils.ReadToNextNullByte(treeReader)), " ")[1])
+// CheckoutCommit updates the files that differ between HEAD's commit and
+// hash, so local changes to the others carry over. It fails without
+// touching anything if a change would be lost or a merge is unresolved.
+// HEAD itself is left to the caller. On an unborn branch every file of hash
+// is written.
+func CheckoutCommit(hash string) (err error) {
+	current, err := index.Read()
 	if err != nil {
 		return err
 	}
-	treeNodes := gitobject.ReadTree(length, treeReader)
+	if unmerged := current.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("%s: needs merge\nerror: you need to resolve your current index first", strings.Join(unmerged, ": needs merge\n"))
+	}
 
-	for _, treeNode := range treeNodes {
-		if treeNode.Mode == 40000 {
-			if err = os.Mkdir(path+treeNode.Name, 0755); err != nil {
-				return err
-			}
-			if err = constructTree(path+treeNode.Name+"/", treeNode.Hash); err != nil {
-				return err
-			}
-		} else {
-			if err = constructBlob(path, treeNode.Name, treeNode.Hash); err != nil {
-				return err
-			}
+	from := []index.Entry{}
+	head, err := refs.Read("HEAD")
+	if err == nil {
+		headIndex, err := CommitIndex(head)
+		if err != nil {
+			return err
 		}
+		from = headIndex.Entries
+	} else if !errors.Is(err, refs.ErrNotFound) {
+		return err
 	}
-
-	return nil
-}
-
-func constructBlob(path string, name string, hash string) (err error) {
-	blobReader, err := gitobject.Reader(hash)
+	target, err := CommitIndex(hash)
 	if err != nil {
 		return err
 	}
-	readerutils.ReadToNextNullByte(blobReader)
-	blobData, err := io.ReadAll(blobReader)
+	return UpdateWorkTree(from, target.Entries, target, "checkout", false)
+}
+
+// CommitIndex is the index holding a commit's tree.
+func CommitIndex(hash string) (idx *index.Index, err error) {
+	commit, err := gitobject.ReadCommit(hash)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return os.WriteFile(path+name, blobData, 0644)
+	return index.FromTree(commit.Tree)
 }
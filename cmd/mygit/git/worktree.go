@@ -0,0 +1,335 @@
+package git
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+)
+
+// workTreeSettings are what the filesystem can be trusted with. Without
+// symlinks, links are written as files holding the path they point at.
+// Without trustFileMode, executable bits are still set, like git does, but
+// a file losing or gaining one isn't a local change.
+type workTreeSettings struct {
+	trustFileMode bool
+	symlinks      bool
+}
+
+// UpdateWorkTree moves the working tree from the files in from to those in
+// to, touching only the paths where the two differ, and gives those paths
+// target's entries in the index. Other paths keep their index entries, so
+// unrelated staged changes survive. Unless force is set, local changes that
+// would be lost make it fail before anything is written; operation names
+// the command in that message.
+func UpdateWorkTree(from []index.Entry, to []index.Entry, target *index.Index, operation string, force bool) (err error) {
+	current, err := index.Read()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	settings := workTreeSettings{}
+	if settings.trustFileMode, err = cfg.GetBool("core.filemode", true); err != nil {
+		return err
+	}
+	if settings.symlinks, err = cfg.GetBool("core.symlinks", true); err != nil {
+		return err
+	}
+	fromFiles, toFiles := entriesByPath(from), entriesByPath(to)
+	targetEntries := map[string][]index.Entry{}
+	for _, entry := range target.Entries {
+		targetEntries[entry.Path] = append(targetEntries[entry.Path], entry)
+	}
+
+	changed := map[string]bool{}
+	for path, file := range fromFiles {
+		if other, found := toFiles[path]; !found || !sameEntry(file, other) {
+			changed[path] = true
+		}
+	}
+	for path := range toFiles {
+		if _, found := fromFiles[path]; !found {
+			changed[path] = true
+		}
+	}
+	// conflicts go into the index even where the working tree stays put,
+	// and old ones are cleared
+	restaged := map[string]bool{}
+	for _, idx := range []*index.Index{current, target} {
+		for _, entry := range idx.Entries {
+			if entry.Stage != 0 {
+				restaged[entry.Path] = true
+			}
+		}
+	}
+	paths := []string{}
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	if !force {
+		if err := checkLocalChanges(paths, fromFiles, toFiles, current, operation, settings); err != nil {
+			return err
+		}
+	}
+
+	// removals go first and deepest first, so a file can take the place
+	// of a directory that is going away
+	for i := len(paths) - 1; i >= 0; i-- {
+		if _, found := toFiles[paths[i]]; !found {
+			if err := removeFile(paths[i]); err != nil {
+				return err
+			}
+		}
+	}
+	written := map[string]bool{}
+	for _, path := range paths {
+		if file, found := toFiles[path]; found {
+			if err := writeFile(file, settings); err != nil {
+				return err
+			}
+			written[path] = true
+		}
+	}
+
+	updated := &index.Index{Version: current.Version, Entries: []index.Entry{}}
+	for _, entry := range current.Entries {
+		if !changed[entry.Path] && !restaged[entry.Path] {
+			updated.Entries = append(updated.Entries, entry)
+		}
+	}
+	for path := range restaged {
+		changed[path] = true
+	}
+	for path := range changed {
+		for _, entry := range targetEntries[path] {
+			if entry.Stage == 0 {
+				if err := fillStat(&entry, current, written[path] && sameEntry(toFiles[path], entry)); err != nil {
+					return err
+				}
+			}
+			updated.Entries = append(updated.Entries, entry)
+		}
+	}
+	return updated.Write()
+}
+
+// checkLocalChanges fails if updating paths would lose staged changes,
+// changes in the working tree or untracked files. A path already holding
+// what it is going to hold is fine.
+func checkLocalChanges(paths []string, fromFiles map[string]index.Entry, toFiles map[string]index.Entry, current *index.Index, operation string, settings workTreeSettings) (err error) {
+	indexInfo, err := os.Stat(".git/index")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// git asks to sort things out before "you merge", but before "you
+	// switch branches" rather than "you checkout"
+	action := operation
+	if operation == "checkout" {
+		action = "switch branches"
+	}
+	overwritten, lostDirectories, untracked := []string{}, []string{}, []string{}
+	for _, path := range paths {
+		old, tracked := fromFiles[path]
+		wanted, kept := toFiles[path]
+		staged, inIndex := current.Find(path, 0)
+		if inIndex && kept && sameEntry(*staged, wanted) {
+			continue
+		}
+		switch {
+		case tracked && (!inIndex || !sameEntry(*staged, old)):
+			overwritten = append(overwritten, path)
+		case tracked:
+			modified, err := workTreeModified(staged, indexInfo, settings)
+			if err != nil {
+				return err
+			}
+			if modified {
+				overwritten = append(overwritten, path)
+			}
+		case inIndex:
+			overwritten = append(overwritten, path)
+		default:
+			info, err := os.Lstat(path)
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				untracked = append(untracked, path)
+				continue
+			}
+			// a directory is fine to replace once its tracked files are gone
+			lost, err := hasUntrackedFiles(path, fromFiles)
+			if err != nil {
+				return err
+			}
+			if lost {
+				lostDirectories = append(lostDirectories, path)
+			}
+		}
+	}
+
+	var message strings.Builder
+	if len(overwritten) > 0 {
+		message.WriteString(fmt.Sprintf("error: Your local changes to the following files would be overwritten by %s:\n\t%s\nPlease commit your changes or stash them before you %s.\n", operation, strings.Join(overwritten, "\n\t"), action))
+	}
+	if len(lostDirectories) > 0 {
+		message.WriteString(fmt.Sprintf("error: Updating the following directories would lose untracked files in them:\n\t%s\n\n", strings.Join(lostDirectories, "\n\t")))
+	}
+	if len(untracked) > 0 {
+		message.WriteString(fmt.Sprintf("error: The following untracked working tree files would be overwritten by %s:\n\t%s\nPlease move or remove them before you %s.\n", operation, strings.Join(untracked, "\n\t"), action))
+	}
+	if message.Len() > 0 {
+		return fmt.Errorf("%sAborting", message.String())
+	}
+	return nil
+}
+
+// hasUntrackedFiles reports whether a directory holds anything besides the
+// tracked files in it.
+func hasUntrackedFiles(directory string, tracked map[string]index.Entry) (found bool, err error) {
+	err = filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, isTracked := tracked[filepath.ToSlash(path)]; !entry.IsDir() && !isTracked {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
+
+// workTreeModified reports whether the working tree copy of a file differs
+// from its index entry, reading it only when the stat data doesn't vouch
+// for it.
+func workTreeModified(entry *index.Entry, indexInfo fs.FileInfo, settings workTreeSettings) (modified bool, err error) {
+	info, err := os.Lstat(entry.Path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var data []byte
+	switch mode := index.TreeMode(entry.Mode); {
+	case mode == 160000:
+		return !info.IsDir(), nil
+	case info.Mode()&fs.ModeSymlink != 0:
+		if mode != 120000 {
+			return true, nil
+		}
+		target, err := os.Readlink(entry.Path)
+		if err != nil {
+			return false, err
+		}
+		data = []byte(target)
+	case info.IsDir() || (mode == 120000 && settings.symlinks):
+		return true, nil
+	default:
+		if mode != 120000 && settings.trustFileMode && (info.Mode()&0111 != 0) != (mode == 100755) {
+			return true, nil
+		}
+		if indexInfo != nil && entry.StatMatches(info, indexInfo) {
+			return false, nil
+		}
+		if data, err = os.ReadFile(entry.Path); err != nil {
+			return false, err
+		}
+	}
+	hash := fmt.Sprintf("%x", gitobject.HashData(append([]byte(fmt.Sprintf("blob %d%c", len(data), 0)), data...)))
+	return hash != entry.Hash, nil
+}
+
+// writeFile puts a file's content in the working tree, replacing whatever
+// is at its path. Symlinks are recreated as links, and submodules get an
+// empty directory.
+func writeFile(file index.Entry, settings workTreeSettings) (err error) {
+	if directory := filepath.Dir(file.Path); directory != "." {
+		if err := os.MkdirAll(directory, 0755); err != nil {
+			return err
+		}
+	}
+	mode := index.TreeMode(file.Mode)
+	if info, err := os.Lstat(file.Path); err == nil && !(mode == 160000 && info.IsDir()) {
+		if err := os.Remove(file.Path); err != nil {
+			return err
+		}
+	}
+	if mode == 160000 {
+		return os.MkdirAll(file.Path, 0755)
+	}
+
+	_, data, err := gitobject.ReadObject(file.Hash)
+	if err != nil {
+		return err
+	}
+	switch {
+	case mode == 120000 && settings.symlinks:
+		return os.Symlink(string(data), file.Path)
+	case mode == 100755:
+		return os.WriteFile(file.Path, data, 0755)
+	}
+	return os.WriteFile(file.Path, data, 0644)
+}
+
+// removeFile deletes a file from the working tree along with the
+// directories it leaves empty. A submodule that was checked out is left.
+func removeFile(path string) (err error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		if info, statErr := os.Lstat(path); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+	for directory := filepath.Dir(path); directory != "."; directory = filepath.Dir(directory) {
+		if os.Remove(directory) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// fillStat gives an entry stat data when the working tree is known to hold
+// its content: the file was just written, or the index already had the
+// same content with stat data. Otherwise the stat data stays empty, which
+// makes the next comparison read the file.
+func fillStat(entry *index.Entry, current *index.Index, written bool) (err error) {
+	if !written {
+		if staged, found := current.Find(entry.Path, 0); found && sameEntry(*staged, *entry) {
+			*entry = *staged
+		}
+		return nil
+	}
+	info, err := os.Lstat(entry.Path)
+	if err != nil {
+		return err
+	}
+	entry.SetStat(info)
+	return nil
+}
+
+func entriesByPath(entries []index.Entry) map[string]index.Entry {
+	byPath := map[string]index.Entry{}
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+	return byPath
+}
+
+func sameEntry(a index.Entry, b index.Entry) bool {
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
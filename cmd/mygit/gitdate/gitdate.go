@@ -0,0 +1,180 @@
+package gitdate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var absoluteLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon Jan _2 15:04:05 2006",
+	"Jan 2 2006",
+	"2 Jan 2006",
+	"2006.01.02",
+	"01/02/2006",
+}
+
+var relativeDate = regexp.MustCompile(`^(\d+)[ .]*(second|minute|hour|day|week|month|year)s?[ .]*(ago)?$`)
+
+// Parse understands the date formats commonly given to git: absolute dates,
+// unix timestamps (optionally prefixed with @ and followed by a zone offset),
+// "now", "yesterday" and relative forms like "2 weeks ago" or "90.days.ago".
+func Parse(value string, now time.Time) (date time.Time, err error) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+
+	switch lower {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	if timestamp, found := strings.CutPrefix(value, "@"); found || isTimestamp(value) {
+		return ParseTimestamp(timestamp)
+	}
+
+	if match := relativeDate.FindStringSubmatch(lower); match != nil {
+		count, _ := strconv.Atoi(match[1])
+		switch match[2] {
+		case "second":
+			return now.Add(-time.Duration(count) * time.Second), nil
+		case "minute":
+			return now.Add(-time.Duration(count) * time.Minute), nil
+		case "hour":
+			return now.Add(-time.Duration(count) * time.Hour), nil
+		case "day":
+			return now.AddDate(0, 0, -count), nil
+		case "week":
+			return now.AddDate(0, 0, -7*count), nil
+		case "month":
+			return now.AddDate(0, -count, 0), nil
+		case "year":
+			return now.AddDate(-count, 0, 0), nil
+		}
+	}
+
+	for _, layout := range absoluteLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse date '%s'", value)
+}
+
+// ParseTimestamp reads the "<unix seconds> <+hhmm>" form git stores in
+// commits and reflogs; the zone is optional.
+func ParseTimestamp(value string) (date time.Time, err error) {
+	seconds, zone, hasZone := strings.Cut(strings.TrimSpace(value), " ")
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad timestamp '%s'", value)
+	}
+	date = time.Unix(unix, 0)
+	if !hasZone {
+		return date, nil
+	}
+	location, err := ParseZone(zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return date.In(location), nil
+}
+
+// ParseZone turns a +hhmm or -hhmm offset into a fixed location.
+func ParseZone(zone string) (location *time.Location, err error) {
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return nil, fmt.Errorf("bad timezone '%s'", zone)
+	}
+	hours, err := strconv.Atoi(zone[1:3])
+	if err != nil {
+		return nil, fmt.Errorf("bad timezone '%s'", zone)
+	}
+	minutes, err := strconv.Atoi(zone[3:5])
+	if err != nil {
+		return nil, fmt.Errorf("bad timezone '%s'", zone)
+	}
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(zone, offset), nil
+}
+
+// FormatTimestamp is the inverse of ParseTimestamp.
+func FormatTimestamp(date time.Time) string {
+	return fmt.Sprintf("%d %s", date.Unix(), date.Format("-0700"))
+}
+
+// a bare number is only taken as a timestamp when it can't be mistaken for
+// something like a year
+func isTimestamp(value string) bool {
+	seconds, _, _ := strings.Cut(value, " ")
+	if len(seconds) < 9 {
+		return false
+	}
+	_, err := strconv.ParseInt(seconds, 10, 64)
+	return err == nil
+}
+
+// Layouts for the ways git shows dates: its default, --date=iso and
+// --date=iso-strict.
+const (
+	DefaultLayout   = "Mon Jan 2 15:04:05 2006 -0700"
+	ISOLayout       = "2006-01-02 15:04:05 -0700"
+	StrictISOLayout = "2006-01-02T15:04:05-07:00"
+)
+
+// FormatRelative describes how long before now date was, the way git's
+// --date=relative does: "5 minutes ago", "3 weeks ago", "2 years, 1 month ago".
+func FormatRelative(date time.Time, now time.Time) string {
+	seconds := int64(now.Sub(date).Seconds())
+	if seconds < 0 {
+		return "in the future"
+	}
+	switch {
+	case seconds < 90:
+		return plural(seconds, "second") + " ago"
+	case seconds < 90*60:
+		return plural((seconds+30)/60, "minute") + " ago"
+	case seconds < 36*60*60:
+		return plural((seconds+30*60)/(60*60), "hour") + " ago"
+	}
+
+	days := (seconds + 12*60*60) / (24 * 60 * 60)
+	switch {
+	case days < 14:
+		return plural(days, "day") + " ago"
+	case days < 70:
+		return plural((days+3)/7, "week") + " ago"
+	case days < 365:
+		return plural((days+15)/30, "month") + " ago"
+	case days < 1825:
+		// say "2 years, 3 months ago" rather than rounding off the months
+		totalMonths := (days*12*2 + 365) / (365 * 2)
+		years, months := totalMonths/12, totalMonths%12
+		if months == 0 {
+			return plural(years, "year") + " ago"
+		}
+		return plural(years, "year") + ", " + plural(months, "month") + " ago"
+	}
+	return plural((days+183)/365, "year") + " ago"
+}
+
+func plural(count int64, unit string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, unit)
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
@@ -0,0 +1,439 @@
+package githttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+)
+
+// Without http.lowSpeedLimit/Time configured a request is only abandoned when
+// no data at all arrives for this long.
+const defaultIdleTimeout = time.Duration(30) * time.Second
+
+const defaultPostBuffer = 1 << 20
+
+// Request bodies smaller than this aren't worth compressing.
+const gzipThreshold = 1024
+
+type Client struct {
+	client        *http.Client
+	extraHeaders  http.Header
+	lowSpeedLimit int
+	lowSpeedTime  time.Duration
+	postBuffer    int
+}
+
+// NewClient builds a client for talking to remoteUrl, honoring the http.*
+// settings (including http.<url>.* overrides) and the matching GIT_* and proxy
+// environment variables.
+func NewClient(remoteUrl string) (client *Client, err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	settings := settings{cfg, matchingUrl(cfg, remoteUrl)}
+
+	tlsConfig := &tls.Config{}
+	sslVerify, err := settings.bool("sslVerify", true)
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv("GIT_SSL_NO_VERIFY") != "" {
+		sslVerify = false
+	}
+	tlsConfig.InsecureSkipVerify = !sslVerify
+
+	caInfo, _ := settings.get("sslCAInfo")
+	if env := os.Getenv("GIT_SSL_CAINFO"); env != "" {
+		caInfo = env
+	}
+	if caInfo != "" {
+		pem, err := os.ReadFile(caInfo)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caInfo)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	proxy, err := proxyFunc(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	client = &Client{extraHeaders: http.Header{}}
+
+	for _, header := range settings.all("extraHeader") {
+		if header == "" {
+			client.extraHeaders = http.Header{}
+			continue
+		}
+		name, value, found := strings.Cut(header, ":")
+		if !found {
+			return nil, fmt.Errorf("bad http.extraHeader value '%s'", header)
+		}
+		client.extraHeaders.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	if client.lowSpeedLimit, err = settings.int("lowSpeedLimit", "GIT_HTTP_LOW_SPEED_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	lowSpeedTime, err := settings.int("lowSpeedTime", "GIT_HTTP_LOW_SPEED_TIME", 0)
+	if err != nil {
+		return nil, err
+	}
+	client.lowSpeedTime = time.Duration(lowSpeedTime) * time.Second
+	if client.postBuffer, err = settings.int("postBuffer", "", defaultPostBuffer); err != nil {
+		return nil, err
+	}
+	if client.postBuffer <= 0 {
+		client.postBuffer = defaultPostBuffer
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsConfig
+	transport.DialContext = (&net.Dialer{Timeout: defaultIdleTimeout, KeepAlive: defaultIdleTimeout}).DialContext
+	client.client = &http.Client{Transport: transport}
+
+	return client, nil
+}
+
+// Get issues a GET request. The response body must be closed by the caller.
+func (c *Client) Get(url string) (response *http.Response, err error) {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(request)
+}
+
+// Post sends body in one piece, gzip compressed when it is large enough to be
+// worth it, if it fits in http.postBuffer. Bigger bodies are streamed with
+// chunked transfer encoding instead, like git does for large negotiations.
+func (c *Client) Post(url string, contentType string, body []byte) (response *http.Response, err error) {
+	if len(body) > c.postBuffer {
+		return c.PostStream(url, contentType, bytes.NewReader(body))
+	}
+
+	contentEncoding := ""
+	if len(body) > gzipThreshold {
+		var compressed bytes.Buffer
+		gzipWriter := gzip.NewWriter(&compressed)
+		if _, err := gzipWriter.Write(body); err != nil {
+			return nil, err
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return nil, err
+		}
+		body = compressed.Bytes()
+		contentEncoding = "gzip"
+	}
+
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		request.Header.Set("Content-Encoding", contentEncoding)
+	}
+	return c.Do(request)
+}
+
+// PostStream sends body with chunked transfer encoding as it is read, so that
+// large uploads such as pushed packs never have to be held in memory.
+func (c *Client) PostStream(url string, contentType string, body io.Reader) (response *http.Response, err error) {
+	request, err := http.NewRequest("POST", url, io.NopCloser(body))
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = -1
+	request.Header.Set("Content-Type", contentType)
+	return c.Do(request)
+}
+
+// Do sends the request with the extra headers applied. The request, including
+// reading the response body, is abandoned once the transfer stalls below the
+// configured speed rather than after a fixed total duration. Compressed
+// responses are decoded transparently.
+func (c *Client) Do(request *http.Request) (response *http.Response, err error) {
+	for name, values := range c.extraHeaders {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+	request.Header.Set("Accept-Encoding", "deflate, gzip")
+
+	ctx, cancel := context.WithCancel(request.Context())
+	watchdog := c.newWatchdog(cancel)
+	if request.Body != nil {
+		// a slow upload is still progress, so it has to keep the watchdog fed
+		request.Body = &watchedUpload{request.Body, watchdog}
+	}
+	response, err = c.client.Do(request.WithContext(ctx))
+	if err != nil {
+		watchdog.stop()
+		if watchdog.expired() {
+			return nil, watchdog.err()
+		}
+		return nil, err
+	}
+	response.Body = &watchedBody{response.Body, watchdog}
+
+	if err := decodeBody(response); err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeBody(response *http.Response) (err error) {
+	var decoder io.ReadCloser
+	switch encoding := strings.ToLower(response.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(response.Body)
+	case "deflate":
+		decoder, err = zlib.NewReader(response.Body)
+	default:
+		return fmt.Errorf("unsupported response content encoding: %s", encoding)
+	}
+	if err != nil {
+		return err
+	}
+	response.Body = &decodedBody{decoder, response.Body}
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	return nil
+}
+
+type decodedBody struct {
+	decoder io.ReadCloser
+	body    io.ReadCloser
+}
+
+func (b *decodedBody) Read(p []byte) (n int, err error) {
+	return b.decoder.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	b.decoder.Close()
+	return b.body.Close()
+}
+
+type watchdog struct {
+	mutex     sync.Mutex
+	timer     *time.Timer
+	cancel    context.CancelFunc
+	window    time.Duration
+	threshold int64
+	received  int64
+	fired     bool
+	limit     int
+}
+
+func (c *Client) newWatchdog(cancel context.CancelFunc) *watchdog {
+	w := &watchdog{cancel: cancel, window: defaultIdleTimeout, threshold: 1}
+	if c.lowSpeedLimit > 0 && c.lowSpeedTime > 0 {
+		w.window = c.lowSpeedTime
+		w.threshold = int64(c.lowSpeedLimit) * int64(c.lowSpeedTime/time.Second)
+		w.limit = c.lowSpeedLimit
+	}
+	w.timer = time.AfterFunc(w.window, func() {
+		w.mutex.Lock()
+		w.fired = true
+		w.mutex.Unlock()
+		cancel()
+	})
+	return w
+}
+
+func (w *watchdog) progress(n int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.fired {
+		return
+	}
+	w.received += int64(n)
+	if w.received >= w.threshold {
+		w.received = 0
+		w.timer.Reset(w.window)
+	}
+}
+
+func (w *watchdog) expired() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.fired
+}
+
+func (w *watchdog) stop() {
+	w.timer.Stop()
+	w.cancel()
+}
+
+func (w *watchdog) err() error {
+	if w.limit > 0 {
+		return fmt.Errorf("operation too slow. Less than %d bytes/sec transferred the last %d seconds", w.limit, int(w.window/time.Second))
+	}
+	return fmt.Errorf("operation timed out: no data received for %d seconds", int(w.window/time.Second))
+}
+
+type watchedBody struct {
+	body     io.ReadCloser
+	watchdog *watchdog
+}
+
+func (b *watchedBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	b.watchdog.progress(n)
+	if err != nil && err != io.EOF && b.watchdog.expired() {
+		err = b.watchdog.err()
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	b.watchdog.stop()
+	return b.body.Close()
+}
+
+type watchedUpload struct {
+	body     io.ReadCloser
+	watchdog *watchdog
+}
+
+func (u *watchedUpload) Read(p []byte) (n int, err error) {
+	n, err = u.body.Read(p)
+	u.watchdog.progress(n)
+	return n, err
+}
+
+func (u *watchedUpload) Close() error {
+	return u.body.Close()
+}
+
+func proxyFunc(settings settings) (proxy func(*http.Request) (*url.URL, error), err error) {
+	proxyUrl, _ := settings.get("proxy")
+	if proxyUrl == "" {
+		for _, name := range []string{"all_proxy", "ALL_PROXY"} {
+			if env := os.Getenv(name); env != "" {
+				proxyUrl = env
+				break
+			}
+		}
+		if proxyUrl == "" {
+			return http.ProxyFromEnvironment, nil
+		}
+		fallback, err := parseProxy(proxyUrl)
+		if err != nil {
+			return nil, err
+		}
+		return func(request *http.Request) (*url.URL, error) {
+			if fromEnv, err := http.ProxyFromEnvironment(request); fromEnv != nil || err != nil {
+				return fromEnv, err
+			}
+			return fallback, nil
+		}, nil
+	}
+	parsed, err := parseProxy(proxyUrl)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(parsed), nil
+}
+
+func parseProxy(proxyUrl string) (parsed *url.URL, err error) {
+	if !strings.Contains(proxyUrl, "://") {
+		proxyUrl = "http://" + proxyUrl
+	}
+	parsed, err = url.Parse(proxyUrl)
+	if err != nil {
+		return nil, fmt.Errorf("bad proxy url '%s': %s", proxyUrl, err)
+	}
+	return parsed, nil
+}
+
+// matchingUrl finds the longest http.<url>.* subsection that is a prefix of
+// remoteUrl.
+func matchingUrl(cfg *config.Config, remoteUrl string) string {
+	best := ""
+	for _, candidate := range cfg.Subsections("http") {
+		prefix := strings.TrimSuffix(candidate, "/")
+		if remoteUrl != prefix && !strings.HasPrefix(remoteUrl, prefix+"/") {
+			continue
+		}
+		if len(candidate) > len(best) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+type settings struct {
+	cfg        *config.Config
+	urlSection string
+}
+
+func (s settings) get(name string) (value string, ok bool) {
+	if s.urlSection != "" {
+		if value, ok := s.cfg.Get("http." + s.urlSection + "." + name); ok {
+			return value, true
+		}
+	}
+	return s.cfg.Get("http." + name)
+}
+
+func (s settings) all(name string) []string {
+	values := s.cfg.GetAll("http." + name)
+	if s.urlSection != "" {
+		values = append(values, s.cfg.GetAll("http."+s.urlSection+"."+name)...)
+	}
+	return values
+}
+
+func (s settings) bool(name string, defaultValue bool) (value bool, err error) {
+	raw, ok := s.get(name)
+	if !ok {
+		return defaultValue, nil
+	}
+	return config.ParseBool(raw)
+}
+
+func (s settings) int(name string, envName string, defaultValue int) (value int, err error) {
+	if envName != "" {
+		if env := os.Getenv(envName); env != "" {
+			value, err := strconv.Atoi(env)
+			if err != nil {
+				return 0, fmt.Errorf("bad %s value '%s'", envName, env)
+			}
+			return value, nil
+		}
+	}
+	raw, ok := s.get(name)
+	if !ok {
+		return defaultValue, nil
+	}
+	return config.ParseInt(raw)
+}
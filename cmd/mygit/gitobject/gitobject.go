@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"compress/zlib"
 	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitdate"
 	"github.com/codecrafters-io/git-starter-go/cmd/mygit/readerutils"
 )
 
@@ -33,6 +37,29 @@ func Type(hash string) (objectType string, err error) {
 	return strings.Split(readerutils.ReadToNextNullByte(reader), " ")[0], nil
 }
 
+// Size returns the length of an object's content.
+func Size(hash string) (size int, err error) {
+	reader, err := Reader(hash)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	parts := strings.Split(readerutils.ReadToNextNullByte(reader), " ")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("object %s has a malformed header", hash)
+	}
+	return strconv.Atoi(parts[1])
+}
+
+// Exists reports whether the object with a full hash is in the object store.
+func Exists(hash string) bool {
+	if len(hash) != 40 {
+		return false
+	}
+	_, err := os.Stat(fmt.Sprintf(".git/objects/%s/%s", hash[:2], hash[2:]))
+	return err == nil
+}
+
 func HashData(data []byte) (hash []byte) {
 	hasher := sha1.New()
 	hasher.Write(data)
@@ -52,13 +79,25 @@ func WriteBlob(data []byte) (hash []byte, err error) {
 	return WriteObject(append(leadingBytes, data...))
 }
 
+// WriteTreeFromDirectory stores the tree of everything under dirpath.
+// Directories with no files in them are left out, as git can't track them.
 func WriteTreeFromDirectory(dirpath string) (hash []byte, err error) {
+	builder, err := buildTreeFromDirectory(dirpath)
+	if err != nil {
+		return nil, err
+	}
+	return builder.Write()
+}
+
+// buildTreeFromDirectory writes the blobs and subtrees under dirpath and
+// collects them into a tree, leaving it to the caller to write.
+func buildTreeFromDirectory(dirpath string) (builder *TreeBuilder, err error) {
 	dirEntries, err := os.ReadDir(dirpath)
 	if err != nil {
 		return nil, err
 	}
 
-	var treeByteBuffer bytes.Buffer
+	builder = NewTreeBuilder()
 	for _, dirEntry := range dirEntries {
 		name := dirEntry.Name()
 		if name == ".git" {
@@ -66,20 +105,104 @@ func WriteTreeFromDirectory(dirpath string) (hash []byte, err error) {
 		}
 		var entryHash []byte
 		var mode int
-		if dirEntry.IsDir() {
-			entryHash, err = WriteTreeFromDirectory(dirpath + "/" + name)
+		path := dirpath + "/" + name
+		switch {
+		case dirEntry.IsDir():
+			// a nested repository is recorded as the commit it has checked
+			// out, like git records submodules
+			var head string
+			if head, err = repositoryHead(path); err != nil {
+				return nil, err
+			}
+			if head != "" {
+				entryHash, err = hex.DecodeString(head)
+				mode = 160000
+				break
+			}
+			var subtree *TreeBuilder
+			if subtree, err = buildTreeFromDirectory(path); err != nil {
+				return nil, err
+			}
+			if subtree.Len() == 0 {
+				continue
+			}
+			entryHash, err = subtree.Write()
 			mode = 40000
-		} else {
-			entryHash, err = WriteBlobFromFile(dirpath + "/" + name)
+		case dirEntry.Type()&fs.ModeSymlink != 0:
+			// a symlink's blob is the path it points at
+			var target string
+			if target, err = os.Readlink(path); err != nil {
+				return nil, err
+			}
+			entryHash, err = WriteBlob([]byte(target))
+			mode = 120000
+		default:
+			var info fs.FileInfo
+			if info, err = dirEntry.Info(); err != nil {
+				return nil, err
+			}
 			mode = 100644
+			if info.Mode()&0111 != 0 {
+				mode = 100755
+			}
+			entryHash, err = WriteBlobFromFile(path)
 		}
 		if err != nil {
 			return nil, err
 		}
-		treeByteBuffer.Write(append([]byte(fmt.Sprintf("%d %s%c", mode, name, 0)), entryHash...))
+		if err := builder.Add(mode, name, hex.EncodeToString(entryHash)); err != nil {
+			return nil, err
+		}
 	}
-	treeBytes := treeByteBuffer.Bytes()
-	return WriteTree(treeBytes)
+	return builder, nil
+}
+
+// repositoryHead returns the commit checked out in the repository at
+// dirpath, or "" when dirpath isn't the top of one.
+func repositoryHead(dirpath string) (hash string, err error) {
+	gitDir := dirpath + "/.git"
+	info, err := os.Stat(gitDir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		// a gitfile points at a repository kept elsewhere
+		content, err := os.ReadFile(gitDir)
+		if err != nil {
+			return "", err
+		}
+		target, found := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+		if !found {
+			return "", fmt.Errorf("invalid gitfile format: %s", gitDir)
+		}
+		if gitDir = target; !filepath.IsAbs(target) {
+			gitDir = filepath.Join(dirpath, target)
+		}
+	}
+
+	content, err := os.ReadFile(gitDir + "/HEAD")
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(content))
+	ref, symbolic := strings.CutPrefix(head, "ref: ")
+	if !symbolic {
+		return head, nil
+	}
+	if content, err := os.ReadFile(gitDir + "/" + ref); err == nil {
+		return strings.TrimSpace(string(content)), nil
+	}
+	if packed, err := os.ReadFile(gitDir + "/packed-refs"); err == nil {
+		for _, line := range strings.Split(string(packed), "\n") {
+			if hash, name, found := strings.Cut(line, " "); found && name == ref {
+				return hash, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("error: '%s' does not have a commit checked out", filepath.Clean(dirpath))
 }
 
 func WriteTree(data []byte) (hash []byte, err error) {
@@ -92,6 +215,11 @@ func WriteCommit(data []byte) (hash []byte, err error) {
 	return WriteObject(append(leadingBytes, data...))
 }
 
+func WriteTag(data []byte) (hash []byte, err error) {
+	leadingBytes := []byte(fmt.Sprintf("tag %d%c", len(data), 0))
+	return WriteObject(append(leadingBytes, data...))
+}
+
 func WriteObject(data []byte) (hash []byte, err error) {
 	hash = HashData(data)
 
@@ -123,14 +251,25 @@ type TreeNode struct {
 	Hash string
 }
 
+// Type is the type of object the entry points at. A submodule's entry is a
+// gitlink to a commit in the submodule's own repository.
+func (n TreeNode) Type() string {
+	switch n.Mode {
+	case 40000:
+		return "tree"
+	case 160000:
+		return "commit"
+	}
+	return "blob"
+}
+
 func ReadTree(length int, reader io.Reader) []TreeNode {
 	result := []TreeNode{}
 	for length > 0 {
 		header := readerutils.ReadToNextNullByte(reader)
-		parts := strings.Split(header, " ")
-
-		mode, _ := strconv.Atoi(parts[0])
-		name := parts[1]
+		// names can have spaces, modes can't
+		modeText, name, _ := strings.Cut(header, " ")
+		mode, _ := strconv.Atoi(modeText)
 		hash := fmt.Sprintf("%x", readerutils.ReadNBytes(20, reader))
 		result = append(result, TreeNode{mode, name, hash})
 
@@ -139,6 +278,269 @@ func ReadTree(length int, reader io.Reader) []TreeNode {
 	return result
 }
 
+// LookupPath finds the entry at a slash separated path below a tree.
+func LookupPath(treeHash string, path string) (node TreeNode, found bool, err error) {
+	node = TreeNode{Mode: 40000, Hash: treeHash}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if node.Mode != 40000 {
+			return TreeNode{}, false, nil
+		}
+		objectType, data, err := ReadObject(node.Hash)
+		if err != nil {
+			return TreeNode{}, false, err
+		}
+		if objectType != "tree" {
+			return TreeNode{}, false, fmt.Errorf("%s is not a tree", node.Hash)
+		}
+		found = false
+		for _, child := range ReadTree(len(data), bytes.NewReader(data)) {
+			if child.Name == name {
+				node, found = child, true
+				break
+			}
+		}
+		if !found {
+			return TreeNode{}, false, nil
+		}
+	}
+	return node, true, nil
+}
+
+// ReadObject returns an object's type and content without its header.
+func ReadObject(hash string) (objectType string, data []byte, err error) {
+	reader, err := Reader(hash)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+	objectType = strings.Split(readerutils.ReadToNextNullByte(reader), " ")[0]
+	data, err = io.ReadAll(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	return objectType, data, nil
+}
+
+// Signature is the identity and time recorded for an author, committer or
+// tagger.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+func ParseSignature(value string) (signature Signature, err error) {
+	open := strings.Index(value, "<")
+	closing := strings.LastIndex(value, ">")
+	if open < 0 || closing < open {
+		return Signature{}, fmt.Errorf("malformed signature: %s", value)
+	}
+	when, err := gitdate.ParseTimestamp(value[closing+1:])
+	if err != nil {
+		return Signature{}, err
+	}
+	return Signature{strings.TrimSpace(value[:open]), value[open+1 : closing], when}, nil
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %s", s.Name, s.Email, gitdate.FormatTimestamp(s.When))
+}
+
+type Tag struct {
+	Object  string
+	Type    string
+	Name    string
+	Tagger  *Signature
+	Message string
+}
+
+func ParseTag(data []byte) (tag *Tag, err error) {
+	headers, message, _ := strings.Cut(string(data), "\n\n")
+	tag = &Tag{Message: message}
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			tagger, err := ParseSignature(value)
+			if err != nil {
+				return nil, err
+			}
+			tag.Tagger = &tagger
+		}
+	}
+	if tag.Object == "" || tag.Type == "" {
+		return nil, fmt.Errorf("malformed tag object")
+	}
+	return tag, nil
+}
+
+func (t *Tag) Bytes() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("object %s\ntype %s\ntag %s\n", t.Object, t.Type, t.Name))
+	if t.Tagger != nil {
+		buffer.WriteString(fmt.Sprintf("tagger %s\n", t.Tagger))
+	}
+	buffer.WriteString("\n")
+	buffer.WriteString(t.Message)
+	return buffer.Bytes()
+}
+
+func ReadTag(hash string) (tag *Tag, err error) {
+	objectType, data, err := ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != "tag" {
+		return nil, fmt.Errorf("%s is not a tag", hash)
+	}
+	return ParseTag(data)
+}
+
+// Commit is a parsed commit object. Headers other than the ones given their
+// own field, such as mergetag, are kept in Extra in their original order,
+// and gpgsig keeps its place among them, so that Bytes reproduces the object
+// exactly.
+type Commit struct {
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	Encoding  string
+	Extra     []CommitHeader
+	GPGSig    string
+	Message   string
+
+	// gpgsigTrailing is how many of the Extra headers come after gpgsig, so
+	// a signature that wasn't last stays where it was
+	gpgsigTrailing int
+}
+
+type CommitHeader struct {
+	Key   string
+	Value string
+}
+
+func ParseCommit(data []byte) (commit *Commit, err error) {
+	headers, message, _ := strings.Cut(string(data), "\n\n")
+	commit = &Commit{Message: message}
+
+	// a header's value continues onto following lines that start with a space
+	fields := []CommitHeader{}
+	for _, line := range strings.Split(headers, "\n") {
+		if continuation, found := strings.CutPrefix(line, " "); found && len(fields) > 0 {
+			fields[len(fields)-1].Value += "\n" + continuation
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		fields = append(fields, CommitHeader{key, value})
+	}
+
+	for _, field := range fields {
+		switch field.Key {
+		case "tree":
+			commit.Tree = field.Value
+		case "parent":
+			commit.Parents = append(commit.Parents, field.Value)
+		case "author":
+			if commit.Author, err = ParseSignature(field.Value); err != nil {
+				return nil, err
+			}
+		case "committer":
+			if commit.Committer, err = ParseSignature(field.Value); err != nil {
+				return nil, err
+			}
+		case "encoding":
+			commit.Encoding = field.Value
+		case "gpgsig":
+			commit.GPGSig = field.Value
+			commit.gpgsigTrailing = 0
+		default:
+			commit.Extra = append(commit.Extra, field)
+			if commit.GPGSig != "" {
+				commit.gpgsigTrailing++
+			}
+		}
+	}
+	if commit.Tree == "" {
+		return nil, fmt.Errorf("malformed commit object: missing tree")
+	}
+	return commit, nil
+}
+
+// Bytes serializes the commit with its headers in the order git writes them.
+func (c *Commit) Bytes() []byte {
+	var buffer bytes.Buffer
+	writeHeader := func(key string, value string) {
+		buffer.WriteString(fmt.Sprintf("%s %s\n", key, strings.ReplaceAll(value, "\n", "\n ")))
+	}
+	writeHeader("tree", c.Tree)
+	for _, parent := range c.Parents {
+		writeHeader("parent", parent)
+	}
+	writeHeader("author", c.Author.String())
+	writeHeader("committer", c.Committer.String())
+	if c.Encoding != "" {
+		writeHeader("encoding", c.Encoding)
+	}
+	// a new signature goes last, as git adds it
+	beforeSignature := len(c.Extra) - min(c.gpgsigTrailing, len(c.Extra))
+	for _, header := range c.Extra[:beforeSignature] {
+		writeHeader(header.Key, header.Value)
+	}
+	if c.GPGSig != "" {
+		writeHeader("gpgsig", c.GPGSig)
+	}
+	for _, header := range c.Extra[beforeSignature:] {
+		writeHeader(header.Key, header.Value)
+	}
+	buffer.WriteString("\n")
+	buffer.WriteString(c.Message)
+	return buffer.Bytes()
+}
+
+// Subject returns the first line of the commit message.
+func (c *Commit) Subject() string {
+	return strings.SplitN(c.Message, "\n", 2)[0]
+}
+
+func ReadCommit(hash string) (commit *Commit, err error) {
+	objectType, data, err := ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != "commit" {
+		return nil, fmt.Errorf("%s is not a commit", hash)
+	}
+	return ParseCommit(data)
+}
+
+// Peel follows annotated tags until it reaches an object that isn't a tag.
+func Peel(hash string) (peeled string, objectType string, err error) {
+	for {
+		objectType, err := Type(hash)
+		if err != nil {
+			return "", "", err
+		}
+		if objectType != "tag" {
+			return hash, objectType, nil
+		}
+		tag, err := ReadTag(hash)
+		if err != nil {
+			return "", "", err
+		}
+		hash = tag.Object
+	}
+}
+
 func Reader(hash string) (reader io.ReadCloser, err error) {
 	filepath, err := fileForHash(hash)
 	if err != nil {
@@ -0,0 +1,119 @@
+package gitobject
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitRoundTrip(t *testing.T) {
+	const (
+		tree      = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"
+		parent    = "parent 2154376a2f1e056bce7321831e30ea94e5d10a42\n"
+		people    = "author A U Thor <author@example.com> 1700000000 +0530\ncommitter C O Mitter <committer@example.com> 1700000100 -0700\n"
+		gpgsig    = "gpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAdFiEE\n -----END PGP SIGNATURE-----\n"
+		mergetag  = "mergetag object 2154376a2f1e056bce7321831e30ea94e5d10a42\n type commit\n tag v1\n tagger T <t@example.com> 1700000000 +0000\n \n v1\n"
+		encoding  = "encoding ISO-8859-1\n"
+		message   = "\nsubject\n\nbody line\n"
+		noMessage = "\n"
+	)
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"plain", tree + parent + people + message},
+		{"root commit without trailing newline", tree + people + "\nsubject"},
+		{"encoding", tree + parent + people + encoding + message},
+		{"signature last", tree + parent + people + mergetag + gpgsig + message},
+		{"signature before mergetag", tree + parent + people + gpgsig + mergetag + message},
+		{"signature between extra headers", tree + parent + people + "x-one a\n" + gpgsig + "x-two b\n" + message},
+		{"empty message", tree + people + noMessage},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commit, err := ParseCommit([]byte(test.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(commit.Bytes()); got != test.raw {
+				t.Errorf("Bytes() =\n%s\nwant\n%s", got, test.raw)
+			}
+		})
+	}
+}
+
+func TestNewSignatureGoesLast(t *testing.T) {
+	commit, err := ParseCommit([]byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@example.com> 1700000000 +0000\ncommitter A <a@example.com> 1700000000 +0000\nmergetag object x\n\nsubject\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit.GPGSig = "signature"
+	if got := string(commit.Bytes()); !strings.Contains(got, "mergetag object x\ngpgsig signature\n\n") {
+		t.Errorf("Bytes() =\n%s\nwant gpgsig after mergetag", got)
+	}
+}
+
+func TestWriteTreeFromDirectorySkipsEmptyDirectories(t *testing.T) {
+	dir := t.TempDir()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+	for _, directory := range []string{".git/objects", "a/b/c", "d/e", "empty"} {
+		if err := os.MkdirAll(directory, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, content := range map[string]string{"d/e/f": "x\n", "top": "y\n"} {
+		if err := os.WriteFile(filepath.FromSlash(path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash, err := WriteTreeFromDirectory(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// what git write-tree gives after git add -A
+	if got, want := hex.EncodeToString(hash), "9714d6a017c53159c4a8304ad2bb7551db31a9fc"; got != want {
+		t.Errorf("WriteTreeFromDirectory() = %s, want %s", got, want)
+	}
+}
+
+func TestTreeRoundTrip(t *testing.T) {
+	builder := NewTreeBuilder()
+	nodes := []TreeNode{
+		{Mode: 100644, Name: "a", Hash: strings.Repeat("1", 40)},
+		{Mode: 100644, Name: "a b", Hash: strings.Repeat("2", 40)},
+		{Mode: 40000, Name: "dir with  spaces", Hash: strings.Repeat("3", 40)},
+		{Mode: 120000, Name: " leading", Hash: strings.Repeat("4", 40)},
+	}
+	for _, node := range nodes {
+		if err := builder.Add(node.Mode, node.Name, node.Hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := builder.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := ReadTree(len(data), bytes.NewReader(data))
+	// entries come back sorted like git sorts them
+	want := []TreeNode{nodes[3], nodes[0], nodes[1], nodes[2]}
+	if len(got) != len(want) {
+		t.Fatalf("ReadTree() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gitobject
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TreeBuilder collects the entries of one tree and serializes them the one
+// way git accepts, so the same content always hashes the same.
+type TreeBuilder struct {
+	nodes []TreeNode
+	names map[string]bool
+}
+
+func NewTreeBuilder() *TreeBuilder {
+	return &TreeBuilder{names: map[string]bool{}}
+}
+
+// Add adds an entry, with mode written the way trees hold it (40000,
+// 100644, 100755, 120000 or 160000) and hash in hex. A name can only be
+// used once, whatever the mode.
+func (b *TreeBuilder) Add(mode int, name string, hash string) (err error) {
+	switch mode {
+	case 40000, 100644, 100755, 120000, 160000:
+	default:
+		return fmt.Errorf("invalid mode %d for tree entry %s", mode, name)
+	}
+	if name == "" || name == "." || name == ".." || name == ".git" || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("invalid tree entry name '%s'", name)
+	}
+	if len(hash) != 40 {
+		return fmt.Errorf("invalid hash %s for tree entry %s", hash, name)
+	}
+	if b.names[name] {
+		return fmt.Errorf("duplicate tree entry %s", name)
+	}
+	b.names[name] = true
+	b.nodes = append(b.nodes, TreeNode{Mode: mode, Name: name, Hash: hash})
+	return nil
+}
+
+// Len is the number of entries added so far.
+func (b *TreeBuilder) Len() int {
+	return len(b.nodes)
+}
+
+// Bytes serializes the entries: sorted by name, with a subtree sorting as if
+// its name ended in a slash, and modes without leading zeros.
+func (b *TreeBuilder) Bytes() (data []byte, err error) {
+	key := func(node TreeNode) string {
+		if node.Mode == 40000 {
+			return node.Name + "/"
+		}
+		return node.Name
+	}
+	nodes := append([]TreeNode{}, b.nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return key(nodes[i]) < key(nodes[j]) })
+
+	var buffer bytes.Buffer
+	for _, node := range nodes {
+		raw, err := hex.DecodeString(node.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash %s for tree entry %s", node.Hash, node.Name)
+		}
+		buffer.WriteString(fmt.Sprintf("%d %s%c", node.Mode, node.Name, 0))
+		buffer.Write(raw)
+	}
+	return buffer.Bytes(), nil
+}
+
+// Write stores the tree as an object.
+func (b *TreeBuilder) Write() (hash []byte, err error) {
+	data, err := b.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return WriteTree(data)
+}
@@ -17,7 +17,7 @@ func Unpack(directory string, reader io.Reader) (err error) {
 		return err
 	}
 
-	if string(packData[:4]) != "PACK" {
+	if len(packData) < 32 || string(packData[:4]) != "PACK" {
 		return fmt.Errorf("not a valid pack")
 	}
 
@@ -32,30 +32,46 @@ func Unpack(directory string, reader io.Reader) (err error) {
 
 	objectCount := binary.BigEndian.Uint32(readerutils.ReadNBytes(4, packBuffer))
 
+	// offset deltas name their base by its position in the pack
+	hashesByOffset := map[int]string{}
+
 	for i := uint32(0); i < objectCount; i++ {
+		offset := len(packData) - packBuffer.Len()
 		oType, size := readTypeAndSize(packBuffer)
+		var hash []byte
 		switch oType {
 		case COMMIT:
-			gitobject.WriteCommit(zlibRead(size, packBuffer))
+			hash, err = gitobject.WriteCommit(zlibRead(size, packBuffer))
 		case TREE:
-			gitobject.WriteTree(zlibRead(size, packBuffer))
+			hash, err = gitobject.WriteTree(zlibRead(size, packBuffer))
 		case BLOB:
-			gitobject.WriteBlob(zlibRead(size, packBuffer))
+			hash, err = gitobject.WriteBlob(zlibRead(size, packBuffer))
 		case TAG:
-			// unsupported
-			zlibRead(size, packBuffer)
+			hash, err = gitobject.WriteTag(zlibRead(size, packBuffer))
 		case OFS_DELTA:
-			return fmt.Errorf("offset deltas aren't currently supported")
+			baseOffset := offset - readOffset(packBuffer)
+			baseHash, ok := hashesByOffset[baseOffset]
+			if !ok {
+				return fmt.Errorf("offset delta base at %d not found", baseOffset)
+			}
+			var targetData []byte
+			if targetData, err = applyDelta(baseHash, zlibRead(size, packBuffer)); err != nil {
+				return err
+			}
+			hash, err = gitobject.WriteObject(targetData)
 		case REF_DELTA:
 			referenceHash := readerutils.ReadNBytes(20, packBuffer)
 			data := zlibRead(size, packBuffer)
-			targetData, err := applyDelta(fmt.Sprintf("%x", referenceHash), data)
-			if err != nil {
+			var targetData []byte
+			if targetData, err = applyDelta(fmt.Sprintf("%x", referenceHash), data); err != nil {
 				return err
 			}
-			gitobject.WriteObject(targetData)
+			hash, err = gitobject.WriteObject(targetData)
 		}
-
+		if err != nil {
+			return err
+		}
+		hashesByOffset[offset] = fmt.Sprintf("%x", hash)
 	}
 
 	return nil
@@ -122,7 +138,7 @@ const (
 	COMMIT    objectType = 0b001
 	TREE      objectType = 0b010
 	BLOB      objectType = 0b011
-	TAG       objectType = 0100
+	TAG       objectType = 0b100
 	OFS_DELTA objectType = 0b110
 	REF_DELTA objectType = 0b111
 )
@@ -163,6 +179,18 @@ func readSize(reader io.Reader) (size uint64) {
 	return size
 }
 
+// readOffset reads the distance back to an offset delta's base, which unlike
+// sizes is big endian with one added to every continuation byte.
+func readOffset(reader io.Reader) (offset int) {
+	b := readerutils.ReadByte(reader)
+	offset = int(b & 0b1111111)
+	for b&0b10000000 != 0 {
+		b = readerutils.ReadByte(reader)
+		offset = ((offset + 1) << 7) | int(b&0b1111111)
+	}
+	return offset
+}
+
 func zlibRead(size uint64, reader io.Reader) (data []byte) {
 	zlibReader, _ := zlib.NewReader(reader)
 	data = readerutils.ReadNBytes(int(size), zlibReader)
@@ -0,0 +1,378 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/readerutils"
+)
+
+const indexFile = ".git/index"
+
+const (
+	flagAssumeValid = 0x8000
+	flagExtended    = 0x4000
+	flagStageMask   = 0x3000
+	flagStageShift  = 12
+)
+
+type Entry struct {
+	CTimeSeconds     uint32
+	CTimeNanoseconds uint32
+	MTimeSeconds     uint32
+	MTimeNanoseconds uint32
+	Dev              uint32
+	Ino              uint32
+	Mode             uint32
+	UID              uint32
+	GID              uint32
+	Size             uint32
+	Hash             string
+	// Stage is 0 for a normal entry and 1 to 3 (base, ours, theirs) for the
+	// sides of an unresolved merge conflict.
+	Stage         int
+	AssumeValid   bool
+	ExtendedFlags uint16
+	Path          string
+}
+
+// Index is the staging area in .git/index: entries sorted by path and then
+// stage.
+type Index struct {
+	Version uint32
+	Entries []Entry
+}
+
+// Read loads .git/index. A repository without one has an empty index.
+func Read() (index *Index, err error) {
+	data, err := os.ReadFile(indexFile)
+	if os.IsNotExist(err) {
+		return &Index{Version: 2, Entries: []Entry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 32 || string(data[:4]) != "DIRC" {
+		return nil, fmt.Errorf("index file is corrupt: bad signature")
+	}
+	content, checksum := data[:len(data)-20], data[len(data)-20:]
+	if !bytes.Equal(gitobject.HashData(content), checksum) {
+		return nil, fmt.Errorf("index file is corrupt: bad checksum")
+	}
+
+	buffer := bytes.NewBuffer(content[4:])
+	index = &Index{Version: binary.BigEndian.Uint32(readerutils.ReadNBytes(4, buffer))}
+	if index.Version < 2 || index.Version > 4 {
+		return nil, fmt.Errorf("index file version %d is not supported", index.Version)
+	}
+	count := binary.BigEndian.Uint32(readerutils.ReadNBytes(4, buffer))
+
+	previousPath := ""
+	for i := uint32(0); i < count; i++ {
+		entryStart := buffer.Len()
+		fields := make([]uint32, 10)
+		for j := range fields {
+			fields[j] = binary.BigEndian.Uint32(readerutils.ReadNBytes(4, buffer))
+		}
+		hash := fmt.Sprintf("%x", readerutils.ReadNBytes(20, buffer))
+		flags := binary.BigEndian.Uint16(readerutils.ReadNBytes(2, buffer))
+		entry := Entry{
+			CTimeSeconds:     fields[0],
+			CTimeNanoseconds: fields[1],
+			MTimeSeconds:     fields[2],
+			MTimeNanoseconds: fields[3],
+			Dev:              fields[4],
+			Ino:              fields[5],
+			Mode:             fields[6],
+			UID:              fields[7],
+			GID:              fields[8],
+			Size:             fields[9],
+			Hash:             hash,
+			Stage:            int(flags&flagStageMask) >> flagStageShift,
+			AssumeValid:      flags&flagAssumeValid != 0,
+		}
+		if flags&flagExtended != 0 {
+			entry.ExtendedFlags = binary.BigEndian.Uint16(readerutils.ReadNBytes(2, buffer))
+		}
+
+		if index.Version == 4 {
+			// paths are stored as a count of bytes to drop from the previous
+			// path followed by the suffix to append
+			strip := readVarint(buffer)
+			suffix := readerutils.ReadToNextNullByte(buffer)
+			entry.Path = previousPath[:len(previousPath)-strip] + suffix
+		} else {
+			entry.Path = readerutils.ReadToNextNullByte(buffer)
+			entryLength := entryStart - buffer.Len()
+			// entries are padded with NULs to a multiple of eight bytes, and the
+			// path's own terminator counts as the first of them
+			padding := (8 - entryLength%8) % 8
+			readerutils.ReadNBytes(padding, buffer)
+		}
+		previousPath = entry.Path
+		index.Entries = append(index.Entries, entry)
+	}
+	return index, nil
+}
+
+// Write saves the index to .git/index through a lock file, in its version's
+// format. Extensions the index was read with are dropped.
+func (i *Index) Write() (err error) {
+	i.Sort()
+	var buffer bytes.Buffer
+	buffer.WriteString("DIRC")
+	version := i.Version
+	if version < 2 {
+		version = 2
+	}
+	for _, entry := range i.Entries {
+		if entry.ExtendedFlags != 0 && version == 2 {
+			version = 3
+		}
+	}
+	binary.Write(&buffer, binary.BigEndian, version)
+	binary.Write(&buffer, binary.BigEndian, uint32(len(i.Entries)))
+
+	previousPath := ""
+	for _, entry := range i.Entries {
+		entryStart := buffer.Len()
+		for _, field := range []uint32{
+			entry.CTimeSeconds, entry.CTimeNanoseconds, entry.MTimeSeconds, entry.MTimeNanoseconds,
+			entry.Dev, entry.Ino, entry.Mode, entry.UID, entry.GID, entry.Size,
+		} {
+			binary.Write(&buffer, binary.BigEndian, field)
+		}
+		hash, err := hex.DecodeString(entry.Hash)
+		if err != nil || len(hash) != 20 {
+			return fmt.Errorf("invalid object name %s for %s", entry.Hash, entry.Path)
+		}
+		buffer.Write(hash)
+
+		flags := uint16(min(len(entry.Path), 0xfff)) | uint16(entry.Stage<<flagStageShift)&flagStageMask
+		if entry.AssumeValid {
+			flags |= flagAssumeValid
+		}
+		if entry.ExtendedFlags != 0 {
+			flags |= flagExtended
+		}
+		binary.Write(&buffer, binary.BigEndian, flags)
+		if entry.ExtendedFlags != 0 {
+			binary.Write(&buffer, binary.BigEndian, entry.ExtendedFlags)
+		}
+
+		if version == 4 {
+			common := 0
+			for common < len(previousPath) && common < len(entry.Path) && previousPath[common] == entry.Path[common] {
+				common++
+			}
+			buffer.Write(encodeVarint(len(previousPath) - common))
+			buffer.WriteString(entry.Path[common:] + "\x00")
+		} else {
+			buffer.WriteString(entry.Path)
+			entryLength := buffer.Len() - entryStart
+			buffer.Write(make([]byte, 8-entryLength%8))
+		}
+		previousPath = entry.Path
+	}
+	buffer.Write(gitobject.HashData(buffer.Bytes()))
+
+	lockFile := indexFile + ".lock"
+	file, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("fatal: Unable to create '%s': File exists.", lockFile)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		file.Close()
+		os.Remove(lockFile)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(lockFile)
+		return err
+	}
+	return os.Rename(lockFile, indexFile)
+}
+
+// Sort puts the entries in index order, by path and then stage.
+func (i *Index) Sort() {
+	sort.SliceStable(i.Entries, func(a, b int) bool {
+		return compareEntry(i.Entries[a].Path, i.Entries[a].Stage, i.Entries[b].Path, i.Entries[b].Stage) < 0
+	})
+}
+
+// Unmerged lists the paths that have conflict stages, in order.
+func (i *Index) Unmerged() (paths []string) {
+	for _, entry := range i.Entries {
+		if entry.Stage != 0 && (len(paths) == 0 || paths[len(paths)-1] != entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	return paths
+}
+
+// WriteTree writes tree objects for the entries and returns the hash of the
+// root tree. It fails while there are unresolved conflicts.
+func (i *Index) WriteTree() (hash string, err error) {
+	if unmerged := i.Unmerged(); len(unmerged) > 0 {
+		return "", fmt.Errorf("error: %s: unmerged\nfatal: git-write-tree: error building trees", unmerged[0])
+	}
+	i.Sort()
+	return writeTree(i.Entries, "")
+}
+
+// writeTree writes the tree for the entries below prefix, which are
+// consecutive in index order.
+func writeTree(entries []Entry, prefix string) (hash string, err error) {
+	builder := gitobject.NewTreeBuilder()
+	for j := 0; j < len(entries); {
+		name := entries[j].Path[len(prefix):]
+		slash := strings.IndexByte(name, '/')
+		if slash < 0 {
+			if err := builder.Add(TreeMode(entries[j].Mode), name, entries[j].Hash); err != nil {
+				return "", err
+			}
+			j++
+			continue
+		}
+
+		directory := prefix + name[:slash+1]
+		end := j
+		for end < len(entries) && strings.HasPrefix(entries[end].Path, directory) {
+			end++
+		}
+		subtree, err := writeTree(entries[j:end], directory)
+		if err != nil {
+			return "", err
+		}
+		if err := builder.Add(40000, name[:slash], subtree); err != nil {
+			return "", err
+		}
+		j = end
+	}
+
+	written, err := builder.Write()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(written), nil
+}
+
+// TreeMode converts an index mode to the way trees write it, octal digits
+// read as a decimal number.
+func TreeMode(mode uint32) int {
+	converted, _ := strconv.Atoi(strconv.FormatUint(uint64(mode), 8))
+	return converted
+}
+
+// EntryMode converts a mode as trees write it to an index mode.
+func EntryMode(mode int) uint32 {
+	converted, _ := strconv.ParseUint(strconv.Itoa(mode), 8, 32)
+	return uint32(converted)
+}
+
+// FromTree builds an index holding the files of a tree at stage 0, without
+// stat data, like read-tree does.
+func FromTree(tree string) (index *Index, err error) {
+	index = &Index{Version: 2, Entries: []Entry{}}
+	if tree != "" {
+		if err := index.addTree(tree, ""); err != nil {
+			return nil, err
+		}
+	}
+	index.Sort()
+	return index, nil
+}
+
+func (i *Index) addTree(tree string, prefix string) (err error) {
+	objectType, data, err := gitobject.ReadObject(tree)
+	if err != nil {
+		return err
+	}
+	if objectType != "tree" {
+		return fmt.Errorf("%s is not a tree", tree)
+	}
+	for _, node := range gitobject.ReadTree(len(data), bytes.NewReader(data)) {
+		if node.Mode == 40000 {
+			if err := i.addTree(node.Hash, prefix+node.Name+"/"); err != nil {
+				return err
+			}
+			continue
+		}
+		i.Entries = append(i.Entries, Entry{Path: prefix + node.Name, Mode: EntryMode(node.Mode), Hash: node.Hash})
+	}
+	return nil
+}
+
+// SetStat records a file's stat data in the entry, so later comparisons
+// can tell it is unchanged without reading it. Only what every platform
+// reports is kept; the change time is taken to be the modification time.
+func (e *Entry) SetStat(info fs.FileInfo) {
+	modified := info.ModTime()
+	e.MTimeSeconds, e.MTimeNanoseconds = uint32(modified.Unix()), uint32(modified.Nanosecond())
+	e.CTimeSeconds, e.CTimeNanoseconds = e.MTimeSeconds, e.MTimeNanoseconds
+	e.Size = uint32(info.Size())
+}
+
+// StatMatches reports whether a file looks unchanged since it was staged.
+// A file modified in the same instant the index was written can't be
+// trusted, since a later change could leave the same timestamp.
+func (e *Entry) StatMatches(info fs.FileInfo, indexInfo fs.FileInfo) bool {
+	modified := info.ModTime()
+	return uint32(modified.Unix()) == e.MTimeSeconds &&
+		uint32(modified.Nanosecond()) == e.MTimeNanoseconds &&
+		uint32(info.Size()) == e.Size &&
+		modified.Before(indexInfo.ModTime())
+}
+
+// Find returns the entry for path at stage.
+func (i *Index) Find(path string, stage int) (entry *Entry, ok bool) {
+	position := sort.Search(len(i.Entries), func(j int) bool {
+		return compareEntry(i.Entries[j].Path, i.Entries[j].Stage, path, stage) >= 0
+	})
+	if position < len(i.Entries) && i.Entries[position].Path == path && i.Entries[position].Stage == stage {
+		return &i.Entries[position], true
+	}
+	return nil, false
+}
+
+func compareEntry(pathA string, stageA int, pathB string, stageB int) int {
+	if pathA != pathB {
+		if pathA < pathB {
+			return -1
+		}
+		return 1
+	}
+	return stageA - stageB
+}
+
+// encodeVarint writes a number the way readVarint reads it.
+func encodeVarint(value int) []byte {
+	encoded := []byte{byte(value & 0b1111111)}
+	for value >>= 7; value > 0; value >>= 7 {
+		value--
+		encoded = append([]byte{0b10000000 | byte(value&0b1111111)}, encoded...)
+	}
+	return encoded
+}
+
+// readVarint reads the offset encoding also used by pack offset deltas.
+func readVarint(buffer *bytes.Buffer) int {
+	b := readerutils.ReadByte(buffer)
+	value := int(b & 0b1111111)
+	for b&0b10000000 != 0 {
+		b = readerutils.ReadByte(buffer)
+		value = ((value + 1) << 7) | int(b&0b1111111)
+	}
+	return value
+}
@@ -37,6 +37,38 @@ func main() {
 		printCommandOutput(commands.CommitTree())
 	case "clone":
 		printCommandOutput(commands.Clone())
+	case "ls-remote":
+		printCommandOutput(commands.LsRemote())
+	case "pack-refs":
+		printCommandOutput(commands.PackRefs())
+	case "update-ref":
+		printCommandOutput(commands.UpdateRef())
+	case "reflog":
+		printCommandOutput(commands.Reflog())
+	case "symbolic-ref":
+		printCommandOutput(commands.SymbolicRef())
+	case "checkout":
+		printCommandOutput(commands.Checkout())
+	case "branch":
+		printCommandOutput(commands.Branch())
+	case "tag":
+		printCommandOutput(commands.Tag())
+	case "rev-parse":
+		printCommandOutput(commands.RevParse())
+	case "log":
+		printCommandOutput(commands.Log())
+	case "rev-list":
+		printCommandOutput(commands.RevList())
+	case "diff":
+		printCommandOutput(commands.Diff())
+	case "diff-tree":
+		printCommandOutput(commands.DiffTree())
+	case "merge":
+		printCommandOutput(commands.Merge())
+	case "merge-base":
+		printCommandOutput(commands.MergeBase())
+	case "submodule":
+		printCommandOutput(commands.Submodule())
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command %s\n", command)
 		os.Exit(1)
@@ -0,0 +1,89 @@
+package merge
+
+import (
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revwalk"
+)
+
+// virtualCommit is a commit or the merge of several merge bases, which only
+// exists as a tree and the real commits it descends from.
+type virtualCommit struct {
+	tree  string
+	heads []string
+}
+
+// Commits merges the commit theirs into ours. With several merge bases, as
+// criss-cross histories have, the bases are merged into a virtual one
+// first, oldest first, their conflicts and all. OurLabel and TheirLabel are
+// taken from options; BaseLabel is set from the merge base.
+func Commits(ours string, theirs string, options Options) (result *Result, err error) {
+	ourCommit, err := commitOf(ours)
+	if err != nil {
+		return nil, err
+	}
+	theirCommit, err := commitOf(theirs)
+	if err != nil {
+		return nil, err
+	}
+	return mergeVirtual(ourCommit, theirCommit, options)
+}
+
+func mergeVirtual(ours virtualCommit, theirs virtualCommit, options Options) (result *Result, err error) {
+	bases, err := revwalk.MergeBases(ours.heads, theirs.heads)
+	if err != nil {
+		return nil, err
+	}
+	base, err := mergeBases(bases, options)
+	if err != nil {
+		return nil, err
+	}
+	options.BaseLabel = baseLabel(bases)
+	return Trees(base.tree, ours.tree, theirs.tree, options)
+}
+
+// mergeBases merges merge bases, which come newest first, into one virtual
+// commit. No bases are the empty tree.
+func mergeBases(bases []string, options Options) (merged virtualCommit, err error) {
+	if len(bases) == 0 {
+		return virtualCommit{}, nil
+	}
+	if merged, err = commitOf(bases[len(bases)-1]); err != nil {
+		return virtualCommit{}, err
+	}
+	options.OurLabel, options.TheirLabel = "Temporary merge branch 1", "Temporary merge branch 2"
+	options.extraMarkerSize += 2
+	for i := len(bases) - 2; i >= 0; i-- {
+		next, err := commitOf(bases[i])
+		if err != nil {
+			return virtualCommit{}, err
+		}
+		result, err := mergeVirtual(merged, next, options)
+		if err != nil {
+			return virtualCommit{}, err
+		}
+		tree, err := result.Tree()
+		if err != nil {
+			return virtualCommit{}, err
+		}
+		merged = virtualCommit{tree: tree, heads: append(merged.heads, next.heads...)}
+	}
+	return merged, nil
+}
+
+func baseLabel(bases []string) string {
+	switch len(bases) {
+	case 0:
+		return "empty tree"
+	case 1:
+		return bases[0][:7]
+	}
+	return "merged common ancestors"
+}
+
+func commitOf(hash string) (commit virtualCommit, err error) {
+	parsed, err := gitobject.ReadCommit(hash)
+	if err != nil {
+		return virtualCommit{}, err
+	}
+	return virtualCommit{tree: parsed.Tree, heads: []string{hash}}, nil
+}
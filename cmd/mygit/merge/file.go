@@ -0,0 +1,276 @@
+package merge
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+)
+
+// markerSize is the length of the runs of <, |, = and > around conflicts.
+const markerSize = 7
+
+// Options control how a merge compares lines and labels its conflicts.
+type Options struct {
+	// OurLabel, TheirLabel and BaseLabel follow the conflict markers for
+	// each side, like "HEAD", the branch name and the merge base.
+	OurLabel   string
+	TheirLabel string
+	BaseLabel  string
+	// Diff3 also shows the base's version of each conflict, between |||||||
+	// and =======.
+	Diff3     bool
+	Algorithm diff.Algorithm
+
+	// extraMarkerSize lengthens the markers of merges nested in the merge
+	// of merge bases, so their conflicts stand apart from the outer ones
+	extraMarkerSize int
+}
+
+// what a hunk of the merge takes
+const (
+	takeConflict = iota
+	takeOurs
+	takeTheirs
+	// takeNeither is a conflict whose sides turned out to be identical, so
+	// it is left as part of ours
+	takeNeither
+)
+
+// hunk is a region the two sides changed, as line offsets and counts into
+// the base, ours and theirs.
+type hunk struct {
+	take        int
+	base        int
+	baseCount   int
+	ours        int
+	oursCount   int
+	theirs      int
+	theirsCount int
+}
+
+// Lines merges the changes from base to theirs into ours, line by line.
+// Changes that touch the same or adjacent lines of the base conflict and are
+// written between markers, unless both sides made the same change. It
+// returns the merged content and how many conflicts it has.
+func Lines(base []byte, ours []byte, theirs []byte, options Options) (merged []byte, conflicts int) {
+	baseLines, ourLines, theirLines := diff.Lines(base), diff.Lines(ours), diff.Lines(theirs)
+	diffOptions := diff.Options{Algorithm: options.Algorithm}
+	ourChanges := diff.Changes(baseLines, ourLines, diffOptions)
+	theirChanges := diff.Changes(baseLines, theirLines, diffOptions)
+	if len(ourChanges) == 0 {
+		return theirs, 0
+	}
+	if len(theirChanges) == 0 {
+		return ours, 0
+	}
+
+	hunks := combine(ourChanges, theirChanges, len(ourLines)-len(baseLines), len(theirLines)-len(baseLines), ourLines, theirLines)
+	// with the base shown, narrowing a conflict to where the sides differ
+	// would no longer line up with it
+	if !options.Diff3 {
+		hunks = refine(hunks, ourLines, theirLines, diffOptions)
+		hunks = simplify(hunks)
+	}
+
+	var buffer bytes.Buffer
+	next := 0
+	for _, h := range hunks {
+		if h.take == takeNeither {
+			continue
+		}
+		writeLines(&buffer, ourLines[next:h.ours], false)
+		switch h.take {
+		case takeOurs:
+			writeLines(&buffer, ourLines[h.ours:h.ours+h.oursCount], false)
+		case takeTheirs:
+			writeLines(&buffer, theirLines[h.theirs:h.theirs+h.theirsCount], false)
+		case takeConflict:
+			conflicts++
+			size := markerSize + options.extraMarkerSize
+			writeMarker(&buffer, '<', size, options.OurLabel)
+			writeLines(&buffer, ourLines[h.ours:h.ours+h.oursCount], true)
+			if options.Diff3 {
+				writeMarker(&buffer, '|', size, options.BaseLabel)
+				writeLines(&buffer, baseLines[h.base:h.base+h.baseCount], true)
+			}
+			writeMarker(&buffer, '=', size, "")
+			writeLines(&buffer, theirLines[h.theirs:h.theirs+h.theirsCount], true)
+			writeMarker(&buffer, '>', size, options.TheirLabel)
+		}
+		next = h.ours + h.oursCount
+	}
+	writeLines(&buffer, ourLines[next:], false)
+	return buffer.Bytes(), conflicts
+}
+
+// combine walks both sides' changes against the base in order. A change
+// only one side made is taken from that side; changes that overlap or touch
+// become one conflict covering both, unless they are the same change.
+func combine(ourChanges []diff.Change, theirChanges []diff.Change, ourGrowth int, theirGrowth int, ourLines []string, theirLines []string) []hunk {
+	hunks := []hunk{}
+	add := func(h hunk) {
+		// hunks that overlap on either side are one
+		if len(hunks) > 0 {
+			last := &hunks[len(hunks)-1]
+			if h.ours <= last.ours+last.oursCount || h.theirs <= last.theirs+last.theirsCount {
+				if h.take != last.take {
+					last.take = takeConflict
+				}
+				last.baseCount = h.base + h.baseCount - last.base
+				last.oursCount = h.ours + h.oursCount - last.ours
+				last.theirsCount = h.theirs + h.theirsCount - last.theirs
+				return
+			}
+		}
+		hunks = append(hunks, h)
+	}
+	oursOnly := func(o diff.Change, theirOffset int) hunk {
+		return hunk{
+			take: takeOurs,
+			base: o.OldStart, baseCount: o.OldEnd - o.OldStart,
+			ours: o.NewStart, oursCount: o.NewEnd - o.NewStart,
+			theirs: o.OldStart + theirOffset, theirsCount: o.OldEnd - o.OldStart,
+		}
+	}
+	theirsOnly := func(t diff.Change, ourOffset int) hunk {
+		return hunk{
+			take: takeTheirs,
+			base: t.OldStart, baseCount: t.OldEnd - t.OldStart,
+			ours: t.OldStart + ourOffset, oursCount: t.OldEnd - t.OldStart,
+			theirs: t.NewStart, theirsCount: t.NewEnd - t.NewStart,
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(ourChanges) && j < len(theirChanges) {
+		o, t := ourChanges[i], theirChanges[j]
+		if o.OldEnd < t.OldStart {
+			add(oursOnly(o, t.NewStart-t.OldStart))
+			i++
+			continue
+		}
+		if t.OldEnd < o.OldStart {
+			add(theirsOnly(t, o.NewStart-o.OldStart))
+			j++
+			continue
+		}
+
+		if o.OldStart != t.OldStart || o.OldEnd != t.OldEnd || !equalLines(ourLines[o.NewStart:o.NewEnd], theirLines[t.NewStart:t.NewEnd]) {
+			// stretch both changes to cover the same lines of the base
+			h := hunk{take: takeConflict, base: o.OldStart, ours: o.NewStart, theirs: t.NewStart}
+			if offset := o.OldStart - t.OldStart; offset > 0 {
+				h.base -= offset
+				h.ours -= offset
+			} else {
+				h.theirs += offset
+			}
+			h.baseCount = o.OldEnd - h.base
+			h.oursCount = o.NewEnd - h.ours
+			h.theirsCount = t.NewEnd - h.theirs
+			if tail := o.OldEnd - t.OldEnd; tail < 0 {
+				h.baseCount -= tail
+				h.oursCount -= tail
+			} else {
+				h.theirsCount += tail
+			}
+			add(h)
+		}
+
+		if o.OldEnd >= t.OldEnd {
+			j++
+		}
+		if t.OldEnd >= o.OldEnd {
+			i++
+		}
+	}
+	for ; i < len(ourChanges); i++ {
+		add(oursOnly(ourChanges[i], theirGrowth))
+	}
+	for ; j < len(theirChanges); j++ {
+		add(theirsOnly(theirChanges[j], ourGrowth))
+	}
+	return hunks
+}
+
+// refine diffs the two sides of each conflict against each other and keeps
+// only the parts that differ as conflicts, so lines both sides added don't
+// end up inside markers.
+func refine(hunks []hunk, ourLines []string, theirLines []string, options diff.Options) []hunk {
+	refined := []hunk{}
+	for _, h := range hunks {
+		if h.take != takeConflict || h.oursCount == 0 || h.theirsCount == 0 {
+			refined = append(refined, h)
+			continue
+		}
+		changes := diff.Changes(ourLines[h.ours:h.ours+h.oursCount], theirLines[h.theirs:h.theirs+h.theirsCount], options)
+		if len(changes) == 0 {
+			h.take = takeNeither
+			refined = append(refined, h)
+			continue
+		}
+		for k, change := range changes {
+			part := hunk{
+				take: takeConflict,
+				ours: h.ours + change.OldStart, oursCount: change.OldEnd - change.OldStart,
+				theirs: h.theirs + change.NewStart, theirsCount: change.NewEnd - change.NewStart,
+			}
+			if k == 0 {
+				part.base, part.baseCount = h.base, h.baseCount
+			}
+			refined = append(refined, part)
+		}
+	}
+	return refined
+}
+
+// simplify joins conflicts separated by three lines or fewer, which reads
+// better than a run of small conflicts.
+func simplify(hunks []hunk) []hunk {
+	if len(hunks) == 0 {
+		return hunks
+	}
+	simplified := []hunk{hunks[0]}
+	for _, next := range hunks[1:] {
+		last := &simplified[len(simplified)-1]
+		if last.take != takeConflict || next.take != takeConflict || next.ours-(last.ours+last.oursCount) > 3 {
+			simplified = append(simplified, next)
+			continue
+		}
+		last.baseCount = next.base + next.baseCount - last.base
+		last.oursCount = next.ours + next.oursCount - last.ours
+		last.theirsCount = next.theirs + next.theirsCount - last.theirs
+	}
+	return simplified
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeLines copies lines out. Inside a conflict the last line gets a
+// newline if it lacks one, so the marker after it starts its own line.
+func writeLines(buffer *bytes.Buffer, lines []string, terminate bool) {
+	for _, line := range lines {
+		buffer.WriteString(line)
+	}
+	if terminate && len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		buffer.WriteString("\n")
+	}
+}
+
+func writeMarker(buffer *bytes.Buffer, marker byte, size int, label string) {
+	buffer.Write(bytes.Repeat([]byte{marker}, size))
+	if label != "" {
+		buffer.WriteString(" " + label)
+	}
+	buffer.WriteString("\n")
+}
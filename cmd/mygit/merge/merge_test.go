@@ -0,0 +1,316 @@
+package merge
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+)
+
+// newRepository moves the test into an empty repository for its objects.
+func newRepository(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+	if err := os.MkdirAll(filepath.Join(".git", "objects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeBlob(t *testing.T, content string) string {
+	t.Helper()
+	hash, err := gitobject.WriteBlob([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(hash)
+}
+
+// writeTree stores files, by path, as regular files in a tree.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	idx := &index.Index{Version: 2}
+	for path, content := range files {
+		idx.Entries = append(idx.Entries, index.Entry{Path: path, Mode: index.EntryMode(100644), Hash: writeBlob(t, content)})
+	}
+	hash, err := idx.WriteTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// writeCommit stores a commit of files made at when, in seconds since the
+// epoch, so merge bases come out in a known order.
+func writeCommit(t *testing.T, files map[string]string, when int, parents ...string) string {
+	t.Helper()
+	var data strings.Builder
+	data.WriteString("tree " + writeTree(t, files) + "\n")
+	for _, parent := range parents {
+		data.WriteString("parent " + parent + "\n")
+	}
+	data.WriteString(fmt.Sprintf("author A U Thor <author@example.com> %d +0000\n", when))
+	data.WriteString(fmt.Sprintf("committer A U Thor <author@example.com> %d +0000\n\ncommit\n", when))
+	hash, err := gitobject.WriteCommit([]byte(data.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(hash)
+}
+
+func readFile(t *testing.T, result *Result, path string) string {
+	t.Helper()
+	file, found := result.Files[path]
+	if !found {
+		t.Fatalf("%s is missing from the merge", path)
+	}
+	_, data, err := gitobject.ReadObject(file.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// stage is an index entry as git ls-files -s shows it, with the content in
+// place of the blob.
+type stage struct {
+	path    string
+	stage   int
+	content string
+}
+
+func expectIndex(t *testing.T, result *Result, want []stage) {
+	t.Helper()
+	got := []string{}
+	for _, entry := range result.Index().Entries {
+		got = append(got, fmt.Sprintf("%o %s %d\t%s", entry.Mode, entry.Hash, entry.Stage, entry.Path))
+	}
+	expected := []string{}
+	for _, s := range want {
+		expected = append(expected, fmt.Sprintf("%o %s %d\t%s", index.EntryMode(100644), writeBlob(t, s.content), s.stage, s.path))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("index =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+// The expected results are what git merge gives for the same histories.
+func TestTrees(t *testing.T) {
+	tests := []struct {
+		name               string
+		diff3              bool
+		base, ours, theirs map[string]string
+		// files are the merged files, with what the working tree gets for
+		// conflicted ones
+		files    map[string]string
+		index    []stage
+		messages []string
+	}{
+		{
+			name:     "clean",
+			base:     map[string]string{"f": "1\n2\n3\n4\n5\n6\n7\n"},
+			ours:     map[string]string{"f": "one\n2\n3\n4\n5\n6\n7\n"},
+			theirs:   map[string]string{"f": "1\n2\n3\n4\n5\n6\nseven\n"},
+			files:    map[string]string{"f": "one\n2\n3\n4\n5\n6\nseven\n"},
+			index:    []stage{{"f", 0, "one\n2\n3\n4\n5\n6\nseven\n"}},
+			messages: []string{"Auto-merging f"},
+		},
+		{
+			name:     "content",
+			base:     map[string]string{"f": "a\nb\nc\n"},
+			ours:     map[string]string{"f": "a\nours\nc\n"},
+			theirs:   map[string]string{"f": "a\ntheirs\nc\n"},
+			files:    map[string]string{"f": "a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> side\nc\n"},
+			index:    []stage{{"f", 1, "a\nb\nc\n"}, {"f", 2, "a\nours\nc\n"}, {"f", 3, "a\ntheirs\nc\n"}},
+			messages: []string{"Auto-merging f", "CONFLICT (content): Merge conflict in f"},
+		},
+		{
+			name:     "diff3",
+			diff3:    true,
+			base:     map[string]string{"f": "a\nb\nc\n"},
+			ours:     map[string]string{"f": "a\nours\nc\n"},
+			theirs:   map[string]string{"f": "a\ntheirs\nc\n"},
+			files:    map[string]string{"f": "a\n<<<<<<< HEAD\nours\n||||||| b26453f\nb\n=======\ntheirs\n>>>>>>> side\nc\n"},
+			index:    []stage{{"f", 1, "a\nb\nc\n"}, {"f", 2, "a\nours\nc\n"}, {"f", 3, "a\ntheirs\nc\n"}},
+			messages: []string{"Auto-merging f", "CONFLICT (content): Merge conflict in f"},
+		},
+		{
+			name:     "add/add",
+			base:     map[string]string{"keep": "k\n"},
+			ours:     map[string]string{"keep": "k\n", "f": "same\nours\n"},
+			theirs:   map[string]string{"keep": "k\n", "f": "same\ntheirs\n"},
+			files:    map[string]string{"keep": "k\n", "f": "same\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> side\n"},
+			index:    []stage{{"f", 2, "same\nours\n"}, {"f", 3, "same\ntheirs\n"}, {"keep", 0, "k\n"}},
+			messages: []string{"Auto-merging f", "CONFLICT (add/add): Merge conflict in f"},
+		},
+		{
+			name:     "modify/delete",
+			base:     map[string]string{"keep": "k\n", "f": "a\n"},
+			ours:     map[string]string{"keep": "k\n", "f": "changed\n"},
+			theirs:   map[string]string{"keep": "k\n"},
+			files:    map[string]string{"keep": "k\n", "f": "changed\n"},
+			index:    []stage{{"f", 1, "a\n"}, {"f", 2, "changed\n"}, {"keep", 0, "k\n"}},
+			messages: []string{"CONFLICT (modify/delete): f deleted in side and modified in HEAD.  Version HEAD of f left in tree."},
+		},
+		{
+			name:     "delete/modify",
+			base:     map[string]string{"keep": "k\n", "f": "a\n"},
+			ours:     map[string]string{"keep": "k\n"},
+			theirs:   map[string]string{"keep": "k\n", "f": "changed\n"},
+			files:    map[string]string{"keep": "k\n", "f": "changed\n"},
+			index:    []stage{{"f", 1, "a\n"}, {"f", 3, "changed\n"}, {"keep", 0, "k\n"}},
+			messages: []string{"CONFLICT (modify/delete): f deleted in HEAD and modified in side.  Version side of f left in tree."},
+		},
+		{
+			name:     "file/directory with our file",
+			base:     map[string]string{"keep": "k\n"},
+			ours:     map[string]string{"keep": "k\n", "d": "file\n"},
+			theirs:   map[string]string{"keep": "k\n", "d/x": "x\n"},
+			files:    map[string]string{"keep": "k\n", "d~HEAD": "file\n", "d/x": "x\n"},
+			index:    []stage{{"d/x", 0, "x\n"}, {"d~HEAD", 2, "file\n"}, {"keep", 0, "k\n"}},
+			messages: []string{"CONFLICT (file/directory): directory in the way of d from HEAD; moving it to d~HEAD instead."},
+		},
+		{
+			name:     "file/directory with their file",
+			base:     map[string]string{"keep": "k\n"},
+			ours:     map[string]string{"keep": "k\n", "d/x": "x\n"},
+			theirs:   map[string]string{"keep": "k\n", "d": "file\n"},
+			files:    map[string]string{"keep": "k\n", "d~side": "file\n", "d/x": "x\n"},
+			index:    []stage{{"d/x", 0, "x\n"}, {"d~side", 3, "file\n"}, {"keep", 0, "k\n"}},
+			messages: []string{"CONFLICT (file/directory): directory in the way of d from side; moving it to d~side instead."},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newRepository(t)
+			// git labels the base with its abbreviated commit
+			options := Options{OurLabel: "HEAD", TheirLabel: "side", BaseLabel: "b26453f", Diff3: test.diff3}
+			result, err := Trees(writeTree(t, test.base), writeTree(t, test.ours), writeTree(t, test.theirs), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(result.Files) != len(test.files) {
+				t.Errorf("merged files = %v, want %d", result.Files, len(test.files))
+			}
+			for path, want := range test.files {
+				if got := readFile(t, result, path); got != want {
+					t.Errorf("%s =\n%s\nwant\n%s", path, got, want)
+				}
+			}
+			expectIndex(t, result, test.index)
+			if !reflect.DeepEqual(result.Messages, test.messages) {
+				t.Errorf("messages = %q, want %q", result.Messages, test.messages)
+			}
+			clean := true
+			for _, s := range test.index {
+				clean = clean && s.stage == 0
+			}
+			if result.Clean() != clean {
+				t.Errorf("Clean() = %v, want %v", result.Clean(), clean)
+			}
+		})
+	}
+}
+
+// TestCommitsCrissCross merges two merges that resolved the same conflict
+// differently. Their two merge bases are merged first, conflict and all,
+// into the base of the outer merge.
+func TestCommitsCrissCross(t *testing.T) {
+	newRepository(t)
+	base := writeCommit(t, map[string]string{"f": "a\nb\nc\n"}, 1700000000)
+	two := writeCommit(t, map[string]string{"f": "a\ntwo\nc\n"}, 1700000100, base)
+	one := writeCommit(t, map[string]string{"f": "a\none\nc\n"}, 1700000200, base)
+	ours := writeCommit(t, map[string]string{"f": "a\nX1\nc\n"}, 1700000300, one, two)
+	theirs := writeCommit(t, map[string]string{"f": "a\nX2\nc\n"}, 1700000400, two, one)
+
+	result, err := Commits(ours, theirs, Options{OurLabel: "HEAD", TheirLabel: "side", Diff3: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	virtualBase := "a\n" +
+		"<<<<<<<<< Temporary merge branch 1\ntwo\n" +
+		"||||||||| " + base[:7] + "\nb\n" +
+		"=========\none\n" +
+		">>>>>>>>> Temporary merge branch 2\n" +
+		"c\n"
+	want := "a\n" +
+		"<<<<<<< HEAD\nX1\n" +
+		"||||||| merged common ancestors\n" + strings.TrimSuffix(strings.TrimPrefix(virtualBase, "a\n"), "c\n") +
+		"=======\nX2\n" +
+		">>>>>>> side\n" +
+		"c\n"
+	if got := readFile(t, result, "f"); got != want {
+		t.Errorf("f =\n%s\nwant\n%s", got, want)
+	}
+	expectIndex(t, result, []stage{{"f", 1, virtualBase}, {"f", 2, "a\nX1\nc\n"}, {"f", 3, "a\nX2\nc\n"}})
+}
+
+func TestLinesConflictMarkers(t *testing.T) {
+	tests := []struct {
+		name               string
+		options            Options
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{
+			name:      "same change on both sides",
+			base:      "a\nb\nc\n",
+			ours:      "a\nB\nc\n",
+			theirs:    "a\nB\nc\n",
+			want:      "a\nB\nc\n",
+			conflicts: 0,
+		},
+		{
+			// conflicts three lines or less apart become one
+			name:      "conflicts close together",
+			options:   Options{OurLabel: "ours", TheirLabel: "theirs"},
+			base:      "1\n2\n3\n4\n5\n",
+			ours:      "one\n2\n3\n4\nfive\n",
+			theirs:    "uno\n2\n3\n4\ncinco\n",
+			want:      "<<<<<<< ours\none\n2\n3\n4\nfive\n=======\nuno\n2\n3\n4\ncinco\n>>>>>>> theirs\n",
+			conflicts: 1,
+		},
+		{
+			name:      "diff3 with an empty base",
+			options:   Options{OurLabel: "ours", TheirLabel: "theirs", BaseLabel: "base", Diff3: true},
+			base:      "a\nc\n",
+			ours:      "a\nb\nc\n",
+			theirs:    "a\nB\nc\n",
+			want:      "a\n<<<<<<< ours\nb\n||||||| base\n=======\nB\n>>>>>>> theirs\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:      "no newline at the end",
+			options:   Options{OurLabel: "ours", TheirLabel: "theirs"},
+			base:      "a\nb",
+			ours:      "a\nours",
+			theirs:    "a\ntheirs",
+			want:      "a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n",
+			conflicts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, conflicts := Lines([]byte(test.base), []byte(test.ours), []byte(test.theirs), test.options)
+			if string(got) != test.want || conflicts != test.conflicts {
+				t.Errorf("Lines() =\n%s\nwith %d conflicts, want\n%s\nwith %d", got, conflicts, test.want, test.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package merge
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/diff"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+)
+
+// Conflict is a path the merge couldn't resolve, with each side's version as
+// it goes into the index stages 1 (base), 2 (ours) and 3 (theirs). A side
+// that has no version is nil.
+type Conflict struct {
+	Path   string
+	Base   *diff.File
+	Ours   *diff.File
+	Theirs *diff.File
+}
+
+// Result is a merged tree. Files holds every path of it; a conflicted path
+// holds what is left in the working tree, such as content with conflict
+// markers.
+type Result struct {
+	Files     map[string]diff.File
+	Conflicts []Conflict
+	// Messages report the content merges and conflicts, like git's
+	// "Auto-merging" and "CONFLICT" lines.
+	Messages []string
+}
+
+// Clean reports whether the merge had no conflicts.
+func (r *Result) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// Tree writes the merged files as tree objects and returns the root's hash.
+func (r *Result) Tree() (hash string, err error) {
+	merged := &index.Index{Version: 2}
+	for _, file := range r.Files {
+		merged.Entries = append(merged.Entries, index.Entry{Path: file.Path, Mode: index.EntryMode(file.Mode), Hash: file.Hash})
+	}
+	return merged.WriteTree()
+}
+
+// Index builds the index for the merge: the merged files at stage 0 and the
+// sides of each conflict at stages 1 to 3. The entries carry no stat data.
+func (r *Result) Index() *index.Index {
+	merged := &index.Index{Version: 2}
+	conflicted := map[string]bool{}
+	for _, conflict := range r.Conflicts {
+		conflicted[conflict.Path] = true
+		for stage, file := range []*diff.File{conflict.Base, conflict.Ours, conflict.Theirs} {
+			if file != nil {
+				merged.Entries = append(merged.Entries, index.Entry{Path: conflict.Path, Mode: index.EntryMode(file.Mode), Hash: file.Hash, Stage: stage + 1})
+			}
+		}
+	}
+	for _, file := range r.Files {
+		if !conflicted[file.Path] {
+			merged.Entries = append(merged.Entries, index.Entry{Path: file.Path, Mode: index.EntryMode(file.Mode), Hash: file.Hash})
+		}
+	}
+	merged.Sort()
+	return merged
+}
+
+// Trees merges the changes from the base tree to theirs into ours, path by
+// path. A file one side renamed is merged at its new path. An empty hash is
+// the empty tree.
+func Trees(base string, ours string, theirs string, options Options) (result *Result, err error) {
+	baseFiles, err := flatten(base)
+	if err != nil {
+		return nil, err
+	}
+	ourFiles, err := flatten(ours)
+	if err != nil {
+		return nil, err
+	}
+	theirFiles, err := flatten(theirs)
+	if err != nil {
+		return nil, err
+	}
+	ourRenames, err := renames(baseFiles, ourFiles)
+	if err != nil {
+		return nil, err
+	}
+	theirRenames, err := renames(baseFiles, theirFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &treeMerge{options: options, result: &Result{Files: map[string]diff.File{}, Conflicts: []Conflict{}, Messages: []string{}}}
+	type sides struct{ base, ours, theirs *diff.File }
+	entries := map[string]*sides{}
+	usedOurs, usedTheirs := map[string]bool{}, map[string]bool{}
+	lookup := func(files map[string]diff.File, path string, used map[string]bool) *diff.File {
+		file, found := files[path]
+		if !found {
+			return nil
+		}
+		used[path] = true
+		return &file
+	}
+
+	for _, basePath := range sortedPaths(baseFiles) {
+		baseFile := baseFiles[basePath]
+		// a rename onto a path the other side has too is left as a
+		// deletion and an addition
+		ourPath, theirPath := basePath, basePath
+		if renamed, found := ourRenames[basePath]; found {
+			if _, taken := theirFiles[renamed]; !taken {
+				ourPath = renamed
+			}
+		}
+		if renamed, found := theirRenames[basePath]; found {
+			if _, taken := ourFiles[renamed]; !taken {
+				theirPath = renamed
+			}
+		}
+
+		ourFile, theirFile := lookup(ourFiles, ourPath, usedOurs), lookup(theirFiles, theirPath, usedTheirs)
+		switch {
+		case ourPath != basePath && theirPath != basePath && ourPath != theirPath:
+			m.message("CONFLICT (rename/rename): %s renamed to %s in %s and to %s in %s.", basePath, ourPath, options.OurLabel, theirPath, options.TheirLabel)
+			m.conflict(ourPath, &baseFile, ourFile, nil, *ourFile)
+			m.conflict(theirPath, &baseFile, nil, theirFile, *theirFile)
+			continue
+		case ourPath != basePath && theirFile == nil:
+			m.message("CONFLICT (rename/delete): %s renamed to %s in %s, but deleted in %s.", basePath, ourPath, options.OurLabel, options.TheirLabel)
+			m.conflict(ourPath, &baseFile, ourFile, nil, *ourFile)
+			continue
+		case theirPath != basePath && ourFile == nil:
+			m.message("CONFLICT (rename/delete): %s renamed to %s in %s, but deleted in %s.", basePath, theirPath, options.TheirLabel, options.OurLabel)
+			m.conflict(theirPath, &baseFile, nil, theirFile, *theirFile)
+			continue
+		}
+		destination := ourPath
+		if theirPath != basePath {
+			destination = theirPath
+		}
+		entries[destination] = &sides{base: &baseFile, ours: ourFile, theirs: theirFile}
+	}
+	for path := range ourFiles {
+		if !usedOurs[path] {
+			entries[path] = &sides{ours: lookup(ourFiles, path, usedOurs)}
+		}
+	}
+	for path := range theirFiles {
+		if !usedTheirs[path] {
+			if entry, found := entries[path]; found {
+				entry.theirs = lookup(theirFiles, path, usedTheirs)
+			} else {
+				entries[path] = &sides{theirs: lookup(theirFiles, path, usedTheirs)}
+			}
+		}
+	}
+
+	paths := []string{}
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		entry := entries[path]
+		if err := m.mergeEntry(path, entry.base, entry.ours, entry.theirs); err != nil {
+			return nil, err
+		}
+	}
+	m.moveFilesOutOfTheWay(ourFiles)
+	return m.result, nil
+}
+
+type treeMerge struct {
+	options Options
+	result  *Result
+}
+
+func (m *treeMerge) message(format string, a ...any) {
+	m.result.Messages = append(m.result.Messages, fmt.Sprintf(format, a...))
+}
+
+// keep puts file in the merged tree at path. A nil file leaves path out.
+func (m *treeMerge) keep(path string, file *diff.File) {
+	if file != nil {
+		m.result.Files[path] = diff.File{Path: path, Mode: file.Mode, Hash: file.Hash}
+	}
+}
+
+// conflict records the sides of a conflict at path, with left being what
+// the working tree gets.
+func (m *treeMerge) conflict(path string, base *diff.File, ours *diff.File, theirs *diff.File, left diff.File) {
+	at := func(file *diff.File) *diff.File {
+		if file == nil {
+			return nil
+		}
+		return &diff.File{Path: path, Mode: file.Mode, Hash: file.Hash}
+	}
+	m.result.Conflicts = append(m.result.Conflicts, Conflict{Path: path, Base: at(base), Ours: at(ours), Theirs: at(theirs)})
+	m.keep(path, &left)
+}
+
+// mergeEntry merges one path's versions: a side that didn't change it
+// yields to the other, and otherwise the contents are merged.
+func (m *treeMerge) mergeEntry(path string, base *diff.File, ours *diff.File, theirs *diff.File) (err error) {
+	switch {
+	case sameFile(ours, theirs):
+		m.keep(path, ours)
+	case sameFile(base, ours):
+		m.keep(path, theirs)
+	case sameFile(base, theirs):
+		m.keep(path, ours)
+	case theirs == nil:
+		m.message("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.", path, m.options.TheirLabel, m.options.OurLabel, m.options.OurLabel, path)
+		m.conflict(path, base, ours, nil, *ours)
+	case ours == nil:
+		m.message("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.", path, m.options.OurLabel, m.options.TheirLabel, m.options.TheirLabel, path)
+		m.conflict(path, base, nil, theirs, *theirs)
+	default:
+		return m.mergeFiles(path, base, ours, theirs)
+	}
+	return nil
+}
+
+// mergeFiles merges two versions that both sides changed. Modes merge like
+// content does; text is merged line by line, and anything else conflicts
+// with our version left in place.
+func (m *treeMerge) mergeFiles(path string, base *diff.File, ours *diff.File, theirs *diff.File) (err error) {
+	kind := "content"
+	if base == nil {
+		kind = "add/add"
+	}
+	merged := diff.File{Path: path, Mode: ours.Mode, Hash: ours.Hash}
+	clean := true
+
+	switch {
+	case ours.Mode == theirs.Mode:
+	case base != nil && ours.Mode == base.Mode:
+		merged.Mode = theirs.Mode
+	case base != nil && theirs.Mode == base.Mode:
+	default:
+		clean = false
+	}
+
+	switch {
+	case ours.Hash == theirs.Hash:
+	case base != nil && ours.Hash == base.Hash:
+		merged.Hash = theirs.Hash
+	case base != nil && theirs.Hash == base.Hash:
+	default:
+		m.message("Auto-merging %s", path)
+		var baseData []byte
+		if base != nil {
+			if baseData, err = readBlob(*base); err != nil {
+				return err
+			}
+		}
+		ourData, err := readBlob(*ours)
+		if err != nil {
+			return err
+		}
+		theirData, err := readBlob(*theirs)
+		if err != nil {
+			return err
+		}
+		if !isRegular(*ours) || !isRegular(*theirs) || diff.IsBinary(baseData) || diff.IsBinary(ourData) || diff.IsBinary(theirData) {
+			if isRegular(*ours) && isRegular(*theirs) {
+				m.message("warning: Cannot merge binary files: %s (%s vs. %s)", path, m.options.OurLabel, m.options.TheirLabel)
+			}
+			clean = false
+			break
+		}
+
+		data, conflicts := Lines(baseData, ourData, theirData, m.options)
+		hash, err := gitobject.WriteBlob(data)
+		if err != nil {
+			return err
+		}
+		merged.Hash = hex.EncodeToString(hash)
+		if conflicts > 0 {
+			clean = false
+		}
+	}
+
+	if clean {
+		m.keep(path, &merged)
+		return nil
+	}
+	m.message("CONFLICT (%s): Merge conflict in %s", kind, path)
+	m.conflict(path, base, ours, theirs, merged)
+	return nil
+}
+
+// moveFilesOutOfTheWay renames merged files that are in the way of a
+// directory the merge also has, to the path with "~" and the label of the
+// side the file came from appended.
+func (m *treeMerge) moveFilesOutOfTheWay(ourFiles map[string]diff.File) {
+	directories := map[string]bool{}
+	for path := range m.result.Files {
+		for directory := path; strings.Contains(directory, "/"); {
+			directory = directory[:strings.LastIndexByte(directory, '/')]
+			directories[directory] = true
+		}
+	}
+
+	for _, path := range sortedPaths(m.result.Files) {
+		if !directories[path] {
+			continue
+		}
+		file := m.result.Files[path]
+		label := m.options.TheirLabel
+		if ours, found := ourFiles[path]; found && ours.Hash == file.Hash && ours.Mode == file.Mode {
+			label = m.options.OurLabel
+		}
+		moved := path + "~" + strings.ReplaceAll(label, "/", "_")
+		m.message("CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.", path, label, moved)
+
+		delete(m.result.Files, path)
+		file.Path = moved
+		m.result.Files[moved] = file
+		found := false
+		for i := range m.result.Conflicts {
+			if m.result.Conflicts[i].Path == path {
+				m.result.Conflicts[i] = moveConflict(m.result.Conflicts[i], moved)
+				found = true
+			}
+		}
+		if !found {
+			conflict := Conflict{Path: path, Theirs: &file}
+			if label == m.options.OurLabel {
+				conflict = Conflict{Path: path, Ours: &file}
+			}
+			m.result.Conflicts = append(m.result.Conflicts, moveConflict(conflict, moved))
+		}
+	}
+}
+
+func moveConflict(conflict Conflict, path string) Conflict {
+	moved := Conflict{Path: path}
+	for _, side := range []struct{ from, to **diff.File }{{&conflict.Base, &moved.Base}, {&conflict.Ours, &moved.Ours}, {&conflict.Theirs, &moved.Theirs}} {
+		if *side.from != nil {
+			*side.to = &diff.File{Path: path, Mode: (*side.from).Mode, Hash: (*side.from).Hash}
+		}
+	}
+	return moved
+}
+
+func sameFile(a *diff.File, b *diff.File) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+func isRegular(file diff.File) bool {
+	return file.Mode/1000 == 100
+}
+
+// renames maps the base paths of files a side renamed to their new paths.
+func renames(baseFiles map[string]diff.File, sideFiles map[string]diff.File) (renamed map[string]string, err error) {
+	changes, err := diff.DetectRenames(diff.Compare(baseFiles, sideFiles), diff.DefaultRenameOptions(), readBlob, readBlob)
+	if err != nil {
+		return nil, err
+	}
+	renamed = map[string]string{}
+	for _, change := range changes {
+		if change.Status == diff.Renamed {
+			renamed[change.Old.Path] = change.New.Path
+		}
+	}
+	return renamed, nil
+}
+
+// flatten lists the files of a tree and its subtrees by path.
+func flatten(tree string) (files map[string]diff.File, err error) {
+	files = map[string]diff.File{}
+	if tree == "" {
+		return files, nil
+	}
+	return files, addTree(tree, "", files)
+}
+
+func addTree(tree string, prefix string, files map[string]diff.File) (err error) {
+	objectType, data, err := gitobject.ReadObject(tree)
+	if err != nil {
+		return err
+	}
+	if objectType != "tree" {
+		return fmt.Errorf("%s is not a tree", tree)
+	}
+	for _, node := range gitobject.ReadTree(len(data), bytes.NewReader(data)) {
+		name := path.Join(prefix, node.Name)
+		if node.Mode == 40000 {
+			if err := addTree(node.Hash, name, files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[name] = diff.File{Path: name, Mode: node.Mode, Hash: node.Hash}
+	}
+	return nil
+}
+
+func readBlob(file diff.File) (data []byte, err error) {
+	if file.Mode == 160000 {
+		return []byte(fmt.Sprintf("Subproject commit %s\n", file.Hash)), nil
+	}
+	_, data, err = gitobject.ReadObject(file.Hash)
+	return data, err
+}
+
+func sortedPaths(files map[string]diff.File) []string {
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,877 @@
+package refs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitdate"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+)
+
+const packedRefsFile = ".git/packed-refs"
+
+// ZeroHash stands for a ref that doesn't exist.
+const ZeroHash = "0000000000000000000000000000000000000000"
+
+var ErrNotFound = errors.New("ref not found")
+
+// git gives up following symbolic refs after this many steps
+const maxSymrefDepth = 5
+
+type Ref struct {
+	Name string
+	Hash string
+	// Peeled is the object an annotated tag ultimately points at, when known.
+	Peeled string
+}
+
+// Read resolves name, following symbolic refs and looking for a loose ref
+// first and falling back to packed-refs.
+func Read(name string) (hash string, err error) {
+	_, hash, err = Resolve(name)
+	return hash, err
+}
+
+// Resolve follows the chain of symbolic refs starting at name, returning the
+// ref at the end of it along with the hash it holds.
+func Resolve(name string) (fullName string, hash string, err error) {
+	seen := map[string]bool{}
+	for depth := 0; ; depth++ {
+		if seen[name] {
+			return "", "", fmt.Errorf("symbolic ref loop detected at %s", name)
+		}
+		if depth >= maxSymrefDepth {
+			return "", "", fmt.Errorf("ref %s nests too deeply", name)
+		}
+		seen[name] = true
+
+		content, err := os.ReadFile(refPath(name))
+		if err == nil {
+			value := strings.TrimSpace(string(content))
+			if target, found := strings.CutPrefix(value, "ref: "); found {
+				name = target
+				continue
+			}
+			return name, value, nil
+		}
+		if !os.IsNotExist(err) && !errors.Is(err, syscall.EISDIR) && !errors.Is(err, syscall.ENOTDIR) {
+			return "", "", err
+		}
+
+		packed, err := readPacked()
+		if err != nil {
+			return "", "", err
+		}
+		if ref, ok := packed[name]; ok {
+			return name, ref.Hash, nil
+		}
+		return name, "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+}
+
+// ReadSymbolic returns the ref that the symbolic ref name points at, which
+// doesn't have to exist yet.
+func ReadSymbolic(name string) (target string, err error) {
+	target, ok := symbolicTarget(name)
+	if !ok {
+		if !Exists(name) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return "", fmt.Errorf("ref %s is not a symbolic ref", name)
+	}
+	return target, nil
+}
+
+// IsDetached reports whether HEAD holds a commit directly instead of naming a
+// branch.
+func IsDetached() bool {
+	_, ok := symbolicTarget("HEAD")
+	return !ok
+}
+
+// WriteSymbolic points the symbolic ref name at target. When this changes
+// which commit name resolves to, the move is recorded in name's reflog.
+func WriteSymbolic(name string, target string, message string) (err error) {
+	if !strings.HasPrefix(target, "refs/") && target != "HEAD" {
+		return fmt.Errorf("refusing to point %s outside of refs/: %s", name, target)
+	}
+	oldHash, err := Read(name)
+	if err != nil {
+		oldHash = ZeroHash
+	}
+
+	refLock, err := lock(refPath(name))
+	if err != nil {
+		return err
+	}
+	defer refLock.rollback()
+	if _, err := refLock.file.WriteString(fmt.Sprintf("ref: %s\n", target)); err != nil {
+		return err
+	}
+	if err = refLock.commit(); err != nil {
+		return err
+	}
+
+	newHash, err := Read(name)
+	if err != nil {
+		newHash = ZeroHash
+	}
+	if oldHash == ZeroHash && newHash == ZeroHash {
+		return nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if !shouldLog(cfg, name) {
+		return nil
+	}
+	return appendReflog(name, ReflogEntry{oldHash, newHash, identity(cfg), time.Now(), message})
+}
+
+// DeleteSymbolic removes the symbolic ref name itself, not what it points at.
+func DeleteSymbolic(name string) (err error) {
+	if _, err := ReadSymbolic(name); err != nil {
+		return err
+	}
+	refLock, err := lock(refPath(name))
+	if err != nil {
+		return err
+	}
+	defer refLock.rollback()
+	return os.Remove(refPath(name))
+}
+
+// Exists reports whether name resolves to an object.
+func Exists(name string) bool {
+	_, err := Read(name)
+	return err == nil
+}
+
+// List returns every ref under prefix (e.g. "refs/heads/") sorted by name, with
+// loose refs taking precedence over packed ones.
+func List(prefix string) (refs []Ref, err error) {
+	packed, err := readPacked()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]Ref{}
+	for name, ref := range packed {
+		if strings.HasPrefix(name, prefix) {
+			byName[name] = ref
+		}
+	}
+
+	err = filepath.WalkDir(".git/refs", func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		name := filepath.ToSlash(strings.TrimPrefix(path, ".git/"))
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		hash, err := Read(name)
+		if err != nil {
+			return nil // dangling symbolic refs aren't listed
+		}
+		byName[name] = Ref{Name: name, Hash: hash}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range byName {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// Write points name at hash as a loose ref, whatever it pointed at before.
+func Write(name string, hash string, message string) (err error) {
+	return Update(name, hash, "", message)
+}
+
+// Update points name at newHash only if it currently points at oldHash. An
+// empty oldHash skips the check and ZeroHash requires that name doesn't exist.
+func Update(name string, newHash string, oldHash string, message string) (err error) {
+	transaction := NewTransaction()
+	transaction.Update(name, newHash, oldHash, message)
+	return transaction.Commit()
+}
+
+// Delete removes name from both the loose refs and packed-refs.
+func Delete(name string) (err error) {
+	if !Exists(name) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	transaction := NewTransaction()
+	transaction.Delete(name, "")
+	return transaction.Commit()
+}
+
+// Pack moves loose refs into packed-refs. Like git, only tags are packed unless
+// all is set, and the loose files are removed unless prune is false.
+func Pack(all bool, prune bool) (err error) {
+	packedLock, err := lock(packedRefsFile)
+	if err != nil {
+		return err
+	}
+	defer packedLock.rollback()
+
+	packed, err := readPacked()
+	if err != nil {
+		return err
+	}
+	loose, err := listLoose()
+	if err != nil {
+		return err
+	}
+
+	packedNow := []Ref{}
+	for _, ref := range loose {
+		if !all && !strings.HasPrefix(ref.Name, "refs/tags/") {
+			// refs that are already packed always get refreshed
+			if _, ok := packed[ref.Name]; !ok {
+				continue
+			}
+		}
+		packed[ref.Name] = ref
+		packedNow = append(packedNow, ref)
+	}
+
+	for name, ref := range packed {
+		if ref.Peeled == "" {
+			ref.Peeled, err = peel(ref.Hash)
+			if err != nil {
+				return err
+			}
+			packed[name] = ref
+		}
+	}
+	if err = writePacked(packedLock, packed); err != nil {
+		return err
+	}
+	if err = packedLock.commit(); err != nil {
+		return err
+	}
+
+	if prune {
+		for _, ref := range packedNow {
+			if err := pruneLoose(ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneLoose removes a loose ref that has just been packed, unless somebody
+// changed it in the meantime.
+func pruneLoose(ref Ref) (err error) {
+	refLock, err := lock(refPath(ref.Name))
+	if err != nil {
+		return err
+	}
+	defer refLock.rollback()
+
+	content, err := os.ReadFile(refPath(ref.Name))
+	if err != nil || strings.TrimSpace(string(content)) != ref.Hash {
+		return nil
+	}
+	if err := os.Remove(refPath(ref.Name)); err != nil {
+		return err
+	}
+	refLock.rollback()
+	removeEmptyParents(ref.Name)
+	return nil
+}
+
+type update struct {
+	name    string
+	newHash string
+	oldHash string
+	message string
+	noDeref bool
+	current string
+}
+
+// Transaction collects ref updates that are applied together: every ref is
+// locked and checked against its expected old value before anything is
+// written, so a failure leaves all of them untouched.
+type Transaction struct {
+	updates []update
+}
+
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// Update queues pointing name at newHash, with oldHash checked like in Update.
+// message is recorded in the reflog.
+func (t *Transaction) Update(name string, newHash string, oldHash string, message string) {
+	t.updates = append(t.updates, update{name: name, newHash: newHash, oldHash: oldHash, message: message})
+}
+
+// UpdateNoDeref is Update for a possibly symbolic ref that should itself be
+// overwritten rather than the ref it points at, e.g. to detach HEAD.
+func (t *Transaction) UpdateNoDeref(name string, newHash string, oldHash string, message string) {
+	t.updates = append(t.updates, update{name: name, newHash: newHash, oldHash: oldHash, message: message, noDeref: true})
+}
+
+// Delete queues removing name, which must currently point at oldHash unless
+// oldHash is empty. The ref's reflog goes with it.
+func (t *Transaction) Delete(name string, oldHash string) {
+	t.updates = append(t.updates, update{name: name, newHash: ZeroHash, oldHash: oldHash})
+}
+
+// Verify queues a check that name points at oldHash without changing it.
+func (t *Transaction) Verify(name string, oldHash string) {
+	t.updates = append(t.updates, update{name: name, oldHash: oldHash})
+}
+
+func (t *Transaction) Commit() (err error) {
+	updates := append([]update{}, t.updates...)
+	for i, update := range updates {
+		if update.noDeref || update.newHash == ZeroHash {
+			continue
+		}
+		// updating a symbolic ref updates the ref at the end of its chain
+		if fullName, _, err := Resolve(update.name); err == nil || errors.Is(err, ErrNotFound) {
+			updates[i].name = fullName
+		} else {
+			return err
+		}
+	}
+	sort.SliceStable(updates, func(i, j int) bool { return updates[i].name < updates[j].name })
+	for i := 1; i < len(updates); i++ {
+		if updates[i].name == updates[i-1].name {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", updates[i].name)
+		}
+	}
+
+	locks := []*lockFile{}
+	defer func() {
+		for _, lock := range locks {
+			lock.rollback()
+		}
+	}()
+
+	needsPacked := false
+	for i, update := range updates {
+		refLock, err := lock(refPath(update.name))
+		if err != nil {
+			return err
+		}
+		locks = append(locks, refLock)
+
+		current, err := Read(update.name)
+		if errors.Is(err, ErrNotFound) {
+			current = ZeroHash
+		} else if err != nil {
+			return err
+		}
+		updates[i].current = current
+		if update.oldHash != "" && update.oldHash != current {
+			if update.oldHash == ZeroHash {
+				return fmt.Errorf("cannot lock ref '%s': reference already exists", update.name)
+			}
+			return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", update.name, current, update.oldHash)
+		}
+
+		switch update.newHash {
+		case "":
+		case ZeroHash:
+			needsPacked = true
+		default:
+			if _, err := refLock.file.WriteString(update.newHash + "\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	var packedLock *lockFile
+	if needsPacked {
+		if packedLock, err = lock(packedRefsFile); err != nil {
+			return err
+		}
+		locks = append(locks, packedLock)
+		packed, err := readPacked()
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, update := range updates {
+			if _, ok := packed[update.name]; ok && update.newHash == ZeroHash {
+				delete(packed, update.name)
+				changed = true
+			}
+		}
+		if !changed {
+			packedLock.rollback()
+			packedLock = nil
+		} else if err = writePacked(packedLock, packed); err != nil {
+			return err
+		}
+	}
+
+	// nothing can fail for a good reason past this point
+	if packedLock != nil {
+		if err = packedLock.commit(); err != nil {
+			return err
+		}
+	}
+	for i, update := range updates {
+		switch update.newHash {
+		case "":
+			locks[i].rollback()
+		case ZeroHash:
+			if err := os.Remove(refPath(update.name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			locks[i].rollback()
+			removeEmptyParents(update.name)
+		default:
+			if err = locks[i].commit(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeReflogs(updates)
+}
+
+func writeReflogs(updates []update) (err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	identity := identity(cfg)
+	now := time.Now()
+	headTarget, headIsSymbolic := symbolicTarget("HEAD")
+
+	for _, update := range updates {
+		if update.newHash == "" {
+			continue
+		}
+		if update.newHash == ZeroHash {
+			if err := os.Remove(logPath(update.name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyLogParents(update.name)
+			continue
+		}
+		entry := ReflogEntry{update.current, update.newHash, identity, now, update.message}
+		if shouldLog(cfg, update.name) {
+			if err := appendReflog(update.name, entry); err != nil {
+				return err
+			}
+		}
+		// moving the branch HEAD is on moves HEAD too
+		if headIsSymbolic && headTarget == update.name && update.name != "HEAD" {
+			if err := appendReflog("HEAD", entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lockFile is git's <file>.lock convention: creating it exclusively claims the
+// file, new content is written to it and renaming it into place publishes the
+// content atomically.
+type lockFile struct {
+	path string
+	file *os.File
+	done bool
+}
+
+func lock(path string) (l *lockFile, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("unable to create '%s.lock': File exists. Another git process seems to be running", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockFile{path: path, file: file}, nil
+}
+
+func (l *lockFile) commit() (err error) {
+	if l.done {
+		return nil
+	}
+	l.done = true
+	if err = l.file.Close(); err != nil {
+		os.Remove(l.path + ".lock")
+		return err
+	}
+	return os.Rename(l.path+".lock", l.path)
+}
+
+func (l *lockFile) rollback() {
+	if l.done {
+		return
+	}
+	l.done = true
+	l.file.Close()
+	os.Remove(l.path + ".lock")
+}
+
+// listLoose returns the loose refs that hold a hash directly.
+func listLoose() (refs []Ref, err error) {
+	err = filepath.WalkDir(".git/refs", func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		value := strings.TrimSpace(string(content))
+		if strings.HasPrefix(value, "ref: ") {
+			return nil
+		}
+		refs = append(refs, Ref{Name: filepath.ToSlash(strings.TrimPrefix(path, ".git/")), Hash: value})
+		return nil
+	})
+	return refs, err
+}
+
+func readPacked() (packed map[string]Ref, err error) {
+	packed = map[string]Ref{}
+	file, err := os.Open(packedRefsFile)
+	if os.IsNotExist(err) {
+		return packed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	previous := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || line[0] == '#':
+			continue
+		case line[0] == '^':
+			if previous == "" {
+				return nil, fmt.Errorf("peeled line without a ref in %s", packedRefsFile)
+			}
+			ref := packed[previous]
+			ref.Peeled = line[1:]
+			packed[previous] = ref
+		default:
+			hash, name, found := strings.Cut(line, " ")
+			if !found {
+				return nil, fmt.Errorf("unexpected line in %s: %s", packedRefsFile, line)
+			}
+			packed[name] = Ref{Name: name, Hash: hash}
+			previous = name
+		}
+	}
+	return packed, scanner.Err()
+}
+
+func writePacked(packedLock *lockFile, packed map[string]Ref) (err error) {
+	names := []string{}
+	for name := range packed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var content strings.Builder
+	content.WriteString("# pack-refs with: peeled fully-peeled sorted \n")
+	for _, name := range names {
+		ref := packed[name]
+		content.WriteString(fmt.Sprintf("%s %s\n", ref.Hash, name))
+		if ref.Peeled != "" && ref.Peeled != ref.Hash {
+			content.WriteString(fmt.Sprintf("^%s\n", ref.Peeled))
+		}
+	}
+	_, err = packedLock.file.WriteString(content.String())
+	return err
+}
+
+// peel is gitobject.Peel for refs whose objects may be missing, which can
+// still be packed, just without a peeled value.
+func peel(hash string) (peeled string, err error) {
+	if _, err := gitobject.Type(hash); err != nil {
+		return hash, nil
+	}
+	peeled, _, err = gitobject.Peel(hash)
+	return peeled, err
+}
+
+// Dwim expands a short name like main or origin/main to the full ref it means,
+// trying the same places as git in the same order.
+func Dwim(name string) (fullName string, err error) {
+	candidates := []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+		"refs/remotes/" + name + "/HEAD",
+	}
+	for _, candidate := range candidates {
+		if candidate == name && !strings.HasPrefix(name, "refs/") && strings.ToUpper(name) != name {
+			// only all-caps names like HEAD live directly in .git
+			continue
+		}
+		if Exists(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// symbolicTarget returns the ref a symbolic ref such as HEAD points at.
+func symbolicTarget(name string) (target string, ok bool) {
+	content, err := os.ReadFile(refPath(name))
+	if err != nil {
+		return "", false
+	}
+	return strings.CutPrefix(strings.TrimSpace(string(content)), "ref: ")
+}
+
+func refPath(name string) string {
+	return ".git/" + name
+}
+
+// removeEmptyParents removes the directories that deleting name left empty,
+// stopping at refs/heads, refs/tags and the like, which git always keeps.
+func removeEmptyParents(name string) {
+	for dir := path.Dir(name); strings.Count(dir, "/") >= 2; dir = path.Dir(dir) {
+		if os.Remove(refPath(dir)) != nil {
+			return
+		}
+	}
+}
+
+type ReflogEntry struct {
+	OldHash  string
+	NewHash  string
+	Identity string
+	Time     time.Time
+	Message  string
+}
+
+// ReadReflog returns the entries of name's reflog oldest first, as they are
+// stored. A ref without a reflog has no entries.
+func ReadReflog(name string) (entries []ReflogEntry, err error) {
+	content, err := os.ReadFile(logPath(name))
+	if os.IsNotExist(err) {
+		return []ReflogEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries = []ReflogEntry{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		header, message, _ := strings.Cut(line, "\t")
+		closing := strings.LastIndex(header, ">")
+		if len(header) < 82 || closing < 82 {
+			return nil, fmt.Errorf("malformed reflog entry for %s: %s", name, line)
+		}
+		date, err := gitdate.ParseTimestamp(header[closing+1:])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ReflogEntry{header[:40], header[41:81], header[82 : closing+1], date, message})
+	}
+	return entries, nil
+}
+
+// WriteReflog replaces name's reflog with entries.
+func WriteReflog(name string, entries []ReflogEntry) (err error) {
+	logLock, err := lock(logPath(name))
+	if err != nil {
+		return err
+	}
+	defer logLock.rollback()
+	for _, entry := range entries {
+		if _, err := logLock.file.WriteString(formatReflogEntry(entry)); err != nil {
+			return err
+		}
+	}
+	return logLock.commit()
+}
+
+func HasReflog(name string) bool {
+	_, err := os.Stat(logPath(name))
+	return err == nil
+}
+
+// ReadAt resolves name@{n}: what name pointed at n updates ago.
+func ReadAt(name string, n int) (hash string, err error) {
+	entries, err := ReadReflog(name)
+	if err != nil {
+		return "", err
+	}
+	if n < len(entries) {
+		return entries[len(entries)-1-n].NewHash, nil
+	}
+	if n == len(entries) && n > 0 && entries[0].OldHash != ZeroHash {
+		return entries[0].OldHash, nil
+	}
+	return "", fmt.Errorf("log for '%s' only has %d entries", name, len(entries))
+}
+
+// ReadAtTime resolves name@{date}: what name pointed at at that time.
+func ReadAtTime(name string, date time.Time) (hash string, err error) {
+	entries, err := ReadReflog(name)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", name)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Time.After(date) {
+			return entries[i].NewHash, nil
+		}
+	}
+	if entries[0].OldHash != ZeroHash {
+		return entries[0].OldHash, nil
+	}
+	return entries[0].NewHash, nil
+}
+
+func identity(cfg *config.Config) string {
+	name, email := cfg.Identity("committer")
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+func shouldLog(cfg *config.Config, name string) bool {
+	if HasReflog(name) {
+		return true
+	}
+	value, ok := cfg.Get("core.logAllRefUpdates")
+	if ok && strings.ToLower(value) == "always" {
+		return true
+	}
+	enabled := true
+	if ok {
+		enabled, _ = config.ParseBool(value)
+	}
+	return enabled && (name == "HEAD" || strings.HasPrefix(name, "refs/heads/") ||
+		strings.HasPrefix(name, "refs/remotes/") || strings.HasPrefix(name, "refs/notes/"))
+}
+
+func appendReflog(name string, entry ReflogEntry) (err error) {
+	path := logPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(formatReflogEntry(entry))
+	return err
+}
+
+func formatReflogEntry(entry ReflogEntry) string {
+	message := strings.TrimSpace(strings.ReplaceAll(entry.Message, "\n", " "))
+	return fmt.Sprintf("%s %s %s %s\t%s\n", entry.OldHash, entry.NewHash, entry.Identity, gitdate.FormatTimestamp(entry.Time), message)
+}
+
+func logPath(name string) string {
+	return ".git/logs/" + name
+}
+
+func removeEmptyLogParents(name string) {
+	for dir := filepath.Dir(logPath(name)); dir != ".git/logs/refs" && dir != ".git/logs" && dir != ".git"; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// ListReflogs returns the names of all refs that have a reflog.
+func ListReflogs() (names []string, err error) {
+	names = []string{}
+	err = filepath.WalkDir(".git/logs", func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		names = append(names, filepath.ToSlash(strings.TrimPrefix(path, ".git/logs/")))
+		return nil
+	})
+	return names, err
+}
+
+// RenameReflog moves the reflog along with a renamed ref.
+func RenameReflog(oldName string, newName string) (err error) {
+	if !HasReflog(oldName) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath(newName)), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(logPath(oldName), logPath(newName)); err != nil {
+		return err
+	}
+	removeEmptyLogParents(oldName)
+	return nil
+}
+
+// CheckName applies git's check-ref-format rules to a full ref name.
+func CheckName(name string) (err error) {
+	invalid := fmt.Errorf("'%s' is not a valid ref name", name)
+	if name == "" || name == "@" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.Contains(name, "..") || strings.Contains(name, "//") ||
+		strings.Contains(name, "@{") || strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return invalid
+	}
+	for _, c := range name {
+		if c < 0x20 {
+			return invalid
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return invalid
+		}
+	}
+	return nil
+}
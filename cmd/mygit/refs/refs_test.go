@@ -0,0 +1,203 @@
+package refs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	hashA = strings.Repeat("a", 40)
+	hashB = strings.Repeat("b", 40)
+	hashC = strings.Repeat("c", 40)
+)
+
+// newRepository moves the test into an empty repository with no config
+// besides its own.
+func newRepository(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, "no-global-config"))
+	if err := os.MkdirAll(".git/refs/heads", 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeRefs(t *testing.T, refs map[string]string) {
+	t.Helper()
+	for name, hash := range refs {
+		if err := Write(name, hash, "setup"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func expectRefs(t *testing.T, refs map[string]string) {
+	t.Helper()
+	for name, want := range refs {
+		got, err := Read(name)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s exists at %s, want it missing", name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("reading %s: %s", name, err)
+		} else if got != want {
+			t.Errorf("%s is at %s, want %s", name, got, want)
+		}
+	}
+}
+
+func lockFiles(t *testing.T) (locks []string) {
+	t.Helper()
+	err := filepath.WalkDir(".git", func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && strings.HasSuffix(path, ".lock") {
+			locks = append(locks, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return locks
+}
+
+func TestTransactionStaleOldValueRejectsEverything(t *testing.T) {
+	newRepository(t)
+	writeRefs(t, map[string]string{"refs/heads/one": hashA, "refs/heads/two": hashA})
+
+	transaction := NewTransaction()
+	transaction.Update("refs/heads/one", hashB, hashA, "move one")
+	transaction.Update("refs/heads/two", hashB, hashC, "move two")
+	err := transaction.Commit()
+	if err == nil || !strings.Contains(err.Error(), "but expected "+hashC) {
+		t.Fatalf("Commit() = %v, want a stale value error", err)
+	}
+
+	expectRefs(t, map[string]string{"refs/heads/one": hashA, "refs/heads/two": hashA})
+	if locks := lockFiles(t); len(locks) > 0 {
+		t.Errorf("lock files left behind: %v", locks)
+	}
+}
+
+func TestTransactionFailsOnExistingLock(t *testing.T) {
+	newRepository(t)
+	writeRefs(t, map[string]string{"refs/heads/one": hashA})
+	if err := os.WriteFile(".git/refs/heads/one.lock", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := NewTransaction()
+	transaction.Update("refs/heads/one", hashB, "", "move one")
+	err := transaction.Commit()
+	if err == nil || !strings.Contains(err.Error(), "File exists") {
+		t.Fatalf("Commit() = %v, want a lock error", err)
+	}
+
+	expectRefs(t, map[string]string{"refs/heads/one": hashA})
+	// the lock belongs to someone else, so it stays
+	if locks := lockFiles(t); len(locks) != 1 || locks[0] != ".git/refs/heads/one.lock" {
+		t.Errorf("lock files = %v, want only the existing one", locks)
+	}
+}
+
+func TestTransactionAppliesAllOrNone(t *testing.T) {
+	tests := []struct {
+		name   string
+		locked string
+		want   map[string]string
+	}{
+		{
+			name: "all",
+			want: map[string]string{"refs/heads/one": hashB, "refs/heads/two": hashC, "refs/tags/three": hashB},
+		},
+		{
+			// the last ref to be locked fails after the others were
+			name:   "none",
+			locked: ".git/refs/tags/three.lock",
+			want:   map[string]string{"refs/heads/one": hashA, "refs/heads/two": hashA, "refs/tags/three": ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newRepository(t)
+			writeRefs(t, map[string]string{"refs/heads/one": hashA, "refs/heads/two": hashA})
+			if test.locked != "" {
+				if err := os.MkdirAll(filepath.Dir(test.locked), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(test.locked, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			transaction := NewTransaction()
+			transaction.Update("refs/heads/one", hashB, hashA, "move one")
+			transaction.Update("refs/heads/two", hashC, "", "move two")
+			transaction.Update("refs/tags/three", hashB, ZeroHash, "create three")
+			err := transaction.Commit()
+			if (err != nil) != (test.locked != "") {
+				t.Fatalf("Commit() = %v", err)
+			}
+
+			expectRefs(t, test.want)
+			if locks := lockFiles(t); len(locks) > 0 && (len(locks) != 1 || locks[0] != test.locked) {
+				t.Errorf("lock files left behind: %v", locks)
+			}
+		})
+	}
+}
+
+func directoryExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func TestDeleteKeepsCategoryDirectories(t *testing.T) {
+	newRepository(t)
+	writeRefs(t, map[string]string{"refs/heads/topic/one": hashA, "refs/heads/main": hashA, "refs/remotes/origin/main": hashA})
+	for _, name := range []string{"refs/heads/topic/one", "refs/heads/main", "refs/remotes/origin/main"} {
+		if err := Delete(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, want := range map[string]bool{
+		".git/refs/heads/topic":    false,
+		".git/refs/heads":          true,
+		".git/refs/remotes/origin": false,
+		".git/refs/remotes":        true,
+	} {
+		if got := directoryExists(path); got != want {
+			t.Errorf("%s exists: %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPackKeepsCategoryDirectories(t *testing.T) {
+	newRepository(t)
+	writeRefs(t, map[string]string{"refs/heads/main": hashA, "refs/tags/v1": hashB})
+	if err := Pack(true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	expectRefs(t, map[string]string{"refs/heads/main": hashA, "refs/tags/v1": hashB})
+	for _, path := range []string{".git/refs/heads", ".git/refs/tags"} {
+		if !directoryExists(path) {
+			t.Errorf("%s was removed", path)
+		}
+	}
+}
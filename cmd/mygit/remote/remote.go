@@ -0,0 +1,330 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/githttp"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/readerutils"
+)
+
+type Ref struct {
+	Hash string
+	Name string
+}
+
+// Advertisement is what the server reports during ref discovery: its refs in
+// the order they were sent and the capabilities trailing the first ref.
+type Advertisement struct {
+	Refs         []Ref
+	Capabilities Capabilities
+}
+
+// Capabilities are the space separated features a server advertises. Most are
+// plain flags; some, like symref and agent, carry a value after an '='.
+type Capabilities struct {
+	values map[string][]string
+}
+
+const agent = "mygit/1.0"
+
+// features we understand when reading a pack, in the order they are requested
+var fetchFeatures = []string{"ofs-delta", "side-band-64k", "thin-pack", "no-progress"}
+
+func ParseCapabilities(raw string) Capabilities {
+	capabilities := Capabilities{map[string][]string{}}
+	for _, field := range strings.Fields(raw) {
+		name, value, _ := strings.Cut(field, "=")
+		capabilities.values[name] = append(capabilities.values[name], value)
+	}
+	return capabilities
+}
+
+func (c Capabilities) Has(name string) bool {
+	_, ok := c.values[name]
+	return ok
+}
+
+// Value returns the first value given for a capability.
+func (c Capabilities) Value(name string) (value string, ok bool) {
+	values := c.values[name]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+func (c Capabilities) Values(name string) []string {
+	return c.values[name]
+}
+
+func NormalizeUrl(remoteUrl string) string {
+	return strings.TrimSuffix(remoteUrl, "/")
+}
+
+// Discover runs the smart HTTP ref discovery for git-upload-pack.
+func Discover(client *githttp.Client, remoteUrl string) (advertisement *Advertisement, err error) {
+	response, err := client.Get(fmt.Sprintf("%s/info/refs?service=git-upload-pack", remoteUrl))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("discovery status: %s", response.Status)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/x-git-upload-pack-advertisement" {
+		return nil, fmt.Errorf("%s is not a smart http server (content type %s)", remoteUrl, contentType)
+	}
+
+	// junk lines before ref data
+	data := readerutils.ReadGitPackLine(response.Body)
+	for data != nil {
+		data = readerutils.ReadGitPackLine(response.Body)
+	}
+
+	advertisement = &Advertisement{Capabilities: ParseCapabilities("")}
+	for data := readerutils.ReadGitPackLine(response.Body); data != nil; data = readerutils.ReadGitPackLine(response.Body) {
+		line := strings.TrimSuffix(string(data), "\n")
+		if len(advertisement.Refs) == 0 {
+			// first ref has trailing capabilities
+			var capabilities string
+			line, capabilities, _ = strings.Cut(line, "\x00")
+			advertisement.Capabilities = ParseCapabilities(capabilities)
+		}
+		hash, name, found := strings.Cut(line, " ")
+		if !found {
+			return nil, fmt.Errorf("malformed ref advertisement line: %s", line)
+		}
+		if name == "capabilities^{}" {
+			// an empty repository only advertises its capabilities
+			continue
+		}
+		advertisement.Refs = append(advertisement.Refs, Ref{hash, name})
+	}
+	return advertisement, nil
+}
+
+// Symref returns the target of a symbolic ref advertised through the symref=
+// capability, e.g. refs/heads/main for HEAD.
+func (a *Advertisement) Symref(name string) (target string, ok bool) {
+	for _, value := range a.Capabilities.Values("symref") {
+		source, target, _ := strings.Cut(value, ":")
+		if source == name {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+func (a *Advertisement) Lookup(name string) (ref Ref, ok bool) {
+	for _, ref := range a.Refs {
+		if ref.Name == name {
+			return ref, true
+		}
+	}
+	return Ref{}, false
+}
+
+// DefaultBranch works out which branch the remote HEAD points at. Servers that
+// don't advertise a symref for HEAD leave us to guess from the hashes, where
+// master wins any tie like it does in git.
+func (a *Advertisement) DefaultBranch() (ref Ref, err error) {
+	if target, ok := a.Symref("HEAD"); ok {
+		ref, ok := a.Lookup(target)
+		if !ok {
+			return Ref{}, fmt.Errorf("remote HEAD refers to nonexistent ref %s", target)
+		}
+		return ref, nil
+	}
+
+	head, ok := a.Lookup("HEAD")
+	if !ok {
+		return Ref{}, fmt.Errorf("no HEAD ref advertized")
+	}
+	if master, ok := a.Lookup("refs/heads/master"); ok && master.Hash == head.Hash {
+		return master, nil
+	}
+	for _, ref := range a.Refs {
+		if ref.Hash == head.Hash && strings.HasPrefix(ref.Name, "refs/heads/") {
+			return ref, nil
+		}
+	}
+	return Ref{}, fmt.Errorf("a ref that matches HEAD could not be found")
+}
+
+// FetchPack asks git-upload-pack for everything reachable from wants and
+// returns the raw pack stream, with any side-band multiplexing already removed.
+// Only features the server advertised are requested.
+func (a *Advertisement) FetchPack(client *githttp.Client, remoteUrl string, wants []string) (pack io.ReadCloser, err error) {
+	requested := []string{}
+	for _, feature := range fetchFeatures {
+		if a.Capabilities.Has(feature) {
+			requested = append(requested, feature)
+		}
+	}
+	if a.Capabilities.Has("agent") {
+		requested = append(requested, "agent="+agent)
+	}
+
+	var request bytes.Buffer
+	for i, want := range wants {
+		if i == 0 && len(requested) > 0 {
+			request.WriteString(pktLine(fmt.Sprintf("want %s %s\n", want, strings.Join(requested, " "))))
+		} else {
+			request.WriteString(pktLine(fmt.Sprintf("want %s\n", want)))
+		}
+	}
+	request.WriteString("0000")
+	request.WriteString(pktLine("done\n"))
+
+	response, err := client.Post(fmt.Sprintf("%s/git-upload-pack", remoteUrl), "application/x-git-upload-pack-request", request.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != 200 {
+		response.Body.Close()
+		return nil, fmt.Errorf("pack status: %s", response.Status)
+	}
+
+	readerutils.ReadGitPackLine(response.Body) // NAK
+	if !a.Capabilities.Has("side-band-64k") {
+		return response.Body, nil
+	}
+	return &sidebandReader{body: response.Body, progress: os.Stderr}, nil
+}
+
+// UnbornHead asks the server, over protocol v2, which branch its HEAD points
+// at when that branch doesn't exist yet. Protocol v0 has no way to advertise
+// this for empty repositories.
+func UnbornHead(client *githttp.Client, remoteUrl string) (target string, err error) {
+	discoveryRequest, err := http.NewRequest("GET", fmt.Sprintf("%s/info/refs?service=git-upload-pack", remoteUrl), nil)
+	if err != nil {
+		return "", err
+	}
+	discoveryRequest.Header.Set("Git-Protocol", "version=2")
+	discoveryResponse, err := client.Do(discoveryRequest)
+	if err != nil {
+		return "", err
+	}
+	defer discoveryResponse.Body.Close()
+	if discoveryResponse.StatusCode != 200 {
+		return "", fmt.Errorf("discovery status: %s", discoveryResponse.Status)
+	}
+
+	// the smart http service header is optional in protocol v2
+	data := readerutils.ReadGitPackLine(discoveryResponse.Body)
+	if strings.HasPrefix(string(data), "# service=") {
+		readerutils.ReadGitPackLine(discoveryResponse.Body)
+		data = readerutils.ReadGitPackLine(discoveryResponse.Body)
+	}
+	if strings.TrimSpace(string(data)) != "version 2" {
+		return "", fmt.Errorf("server does not support protocol v2")
+	}
+	unbornSupported := false
+	for data := readerutils.ReadGitPackLine(discoveryResponse.Body); data != nil; data = readerutils.ReadGitPackLine(discoveryResponse.Body) {
+		name, value, _ := strings.Cut(strings.TrimSpace(string(data)), "=")
+		if name == "ls-refs" && slices.Contains(strings.Fields(value), "unborn") {
+			unbornSupported = true
+		}
+	}
+	if !unbornSupported {
+		return "", fmt.Errorf("server does not report unborn refs")
+	}
+
+	var body bytes.Buffer
+	body.WriteString(pktLine("command=ls-refs\n"))
+	body.WriteString("0001")
+	body.WriteString(pktLine("symrefs\n"))
+	body.WriteString(pktLine("unborn\n"))
+	body.WriteString(pktLine("ref-prefix HEAD\n"))
+	body.WriteString("0000")
+	lsRefsRequest, err := http.NewRequest("POST", fmt.Sprintf("%s/git-upload-pack", remoteUrl), &body)
+	if err != nil {
+		return "", err
+	}
+	lsRefsRequest.Header.Set("Git-Protocol", "version=2")
+	lsRefsRequest.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	lsRefsResponse, err := client.Do(lsRefsRequest)
+	if err != nil {
+		return "", err
+	}
+	defer lsRefsResponse.Body.Close()
+	if lsRefsResponse.StatusCode != 200 {
+		return "", fmt.Errorf("ls-refs status: %s", lsRefsResponse.Status)
+	}
+
+	for data := readerutils.ReadGitPackLine(lsRefsResponse.Body); data != nil; data = readerutils.ReadGitPackLine(lsRefsResponse.Body) {
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 || fields[1] != "HEAD" {
+			continue
+		}
+		for _, attribute := range fields[2:] {
+			if target, found := strings.CutPrefix(attribute, "symref-target:"); found {
+				return target, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("server did not report where HEAD points")
+}
+
+func pktLine(data string) string {
+	return fmt.Sprintf("%04x%s", len(data)+4, data)
+}
+
+// sidebandReader demultiplexes a side-band-64k stream: band 1 is pack data,
+// band 2 progress messages and band 3 a fatal error from the server.
+type sidebandReader struct {
+	body     io.ReadCloser
+	progress io.Writer
+	pending  []byte
+	done     bool
+}
+
+func (r *sidebandReader) Read(p []byte) (n int, err error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		data := readerutils.ReadGitPackLine(r.body)
+		if len(data) == 0 {
+			r.done = true
+			continue
+		}
+		switch data[0] {
+		case 1:
+			r.pending = data[1:]
+		case 2:
+			r.progress.Write(data[1:])
+		case 3:
+			return 0, fmt.Errorf("remote error: %s", strings.TrimSpace(string(data[1:])))
+		default:
+			return 0, fmt.Errorf("unknown side-band %d", data[0])
+		}
+	}
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *sidebandReader) Close() error {
+	return r.body.Close()
+}
+
+// ResolveUrl turns a configured remote name such as origin into its url.
+// Anything else is assumed to already be a url.
+func ResolveUrl(nameOrUrl string) (remoteUrl string, err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	if configured, ok := cfg.Get(fmt.Sprintf("remote.%s.url", nameOrUrl)); ok {
+		return NormalizeUrl(configured), nil
+	}
+	return NormalizeUrl(nameOrUrl), nil
+}
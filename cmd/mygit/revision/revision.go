@@ -0,0 +1,367 @@
+package revision
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitdate"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/index"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/revwalk"
+)
+
+var (
+	fullHash  = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	shortHash = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+	indexPath = regexp.MustCompile(`^([0-3]):(.*)$`)
+)
+
+// Spec is a revision argument such as main, ^main, A..B or A...B, expanded
+// into the commits it includes and the commits whose history it excludes.
+type Spec struct {
+	Include []string
+	Exclude []string
+}
+
+// ParseSpec expands a single command line revision argument. A..B includes B
+// and excludes A; A...B includes both and excludes their merge bases. An
+// empty side of a range means HEAD.
+func ParseSpec(arg string) (spec Spec, err error) {
+	if excluded, found := strings.CutPrefix(arg, "^"); found {
+		hash, err := Resolve(excluded)
+		if err != nil {
+			return Spec{}, err
+		}
+		return Spec{Exclude: []string{hash}}, nil
+	}
+
+	if from, to, found := strings.Cut(arg, "..."); found {
+		fromHash, toHash, err := resolveEnds(from, to)
+		if err != nil {
+			return Spec{}, err
+		}
+		bases, err := revwalk.MergeBases([]string{fromHash}, []string{toHash})
+		if err != nil {
+			return Spec{}, err
+		}
+		return Spec{Include: []string{toHash, fromHash}, Exclude: bases}, nil
+	}
+	if from, to, found := strings.Cut(arg, ".."); found {
+		fromHash, toHash, err := resolveEnds(from, to)
+		if err != nil {
+			return Spec{}, err
+		}
+		return Spec{Include: []string{toHash}, Exclude: []string{fromHash}}, nil
+	}
+
+	hash, err := Resolve(arg)
+	if err != nil {
+		return Spec{}, err
+	}
+	return Spec{Include: []string{hash}}, nil
+}
+
+func resolveEnds(from string, to string) (fromHash string, toHash string, err error) {
+	if from == "" {
+		from = "HEAD"
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	if fromHash, err = Resolve(from + "^{commit}"); err != nil {
+		return "", "", err
+	}
+	if toHash, err = Resolve(to + "^{commit}"); err != nil {
+		return "", "", err
+	}
+	return fromHash, toHash, nil
+}
+
+// Resolve turns a revision expression naming a single object into its full
+// hash. It understands ref names, full and abbreviated hashes, @ for HEAD,
+// reflog lookups like main@{2} or HEAD@{yesterday}, @{upstream}, the ~n, ^n,
+// ^{type} and ^{} suffixes, <rev>:<path> for an entry in a tree and
+// :<path> or :<stage>:<path> for an entry in the index.
+func Resolve(expr string) (hash string, err error) {
+	if path, found := strings.CutPrefix(expr, ":"); found {
+		return resolveIndexPath(path)
+	}
+	if colon := topLevelIndex(expr, ":"); colon >= 0 {
+		treeish, err := Resolve(expr[:colon])
+		if err != nil {
+			return "", err
+		}
+		return resolveTreePath(treeish, expr[colon+1:])
+	}
+
+	end := topLevelIndex(expr, "^~")
+	if end < 0 {
+		end = len(expr)
+	}
+	if hash, err = resolveName(expr[:end]); err != nil {
+		return "", err
+	}
+
+	suffixes := expr[end:]
+	for len(suffixes) > 0 {
+		operator := suffixes[0]
+		suffixes = suffixes[1:]
+
+		if operator == '^' && strings.HasPrefix(suffixes, "{") {
+			closing := strings.Index(suffixes, "}")
+			if closing < 0 {
+				return "", fmt.Errorf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.", expr)
+			}
+			objectType := suffixes[1:closing]
+			suffixes = suffixes[closing+1:]
+			if objectType == "" {
+				hash, _, err = gitobject.Peel(hash)
+			} else {
+				hash, err = PeelTo(hash, objectType)
+			}
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		digits := len(suffixes) - len(strings.TrimLeft(suffixes, "0123456789"))
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(suffixes[:digits])
+			suffixes = suffixes[digits:]
+		}
+		if hash, err = PeelTo(hash, "commit"); err != nil {
+			return "", err
+		}
+		if operator == '~' {
+			hash, err = ancestor(hash, n, expr)
+		} else {
+			hash, err = parent(hash, n, expr)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+// PeelTo dereferences tags, and commits to their trees, until it reaches an
+// object of the wanted type. "object" accepts whatever hash names.
+func PeelTo(hash string, objectType string) (peeled string, err error) {
+	for {
+		actualType, err := gitobject.Type(hash)
+		if err != nil {
+			return "", err
+		}
+		if actualType == objectType || objectType == "object" {
+			return hash, nil
+		}
+		switch {
+		case actualType == "tag":
+			tag, err := gitobject.ReadTag(hash)
+			if err != nil {
+				return "", err
+			}
+			hash = tag.Object
+		case actualType == "commit" && objectType == "tree":
+			commit, err := gitobject.ReadCommit(hash)
+			if err != nil {
+				return "", err
+			}
+			hash = commit.Tree
+		default:
+			return "", fmt.Errorf("%s^{%s}: expected %s type, but the object dereferences to %s type", hash, objectType, objectType, actualType)
+		}
+	}
+}
+
+// resolveName handles the part of an expression before any suffix.
+func resolveName(name string) (hash string, err error) {
+	if name == "@" {
+		name = "HEAD"
+	}
+
+	if at := strings.Index(name, "@{"); at >= 0 && strings.HasSuffix(name, "}") {
+		ref, err := branchForAt(name[:at])
+		if err != nil {
+			return "", err
+		}
+		spec := name[at+2 : len(name)-1]
+
+		switch strings.ToLower(spec) {
+		case "u", "upstream":
+			if ref == "HEAD" {
+				if target, err := refs.ReadSymbolic("HEAD"); err == nil {
+					ref = target
+				}
+			}
+			branch, found := strings.CutPrefix(ref, "refs/heads/")
+			if !found {
+				return "", fmt.Errorf("fatal: HEAD does not point to a branch")
+			}
+			upstream, err := Upstream(branch)
+			if err != nil {
+				return "", err
+			}
+			return refs.Read(upstream)
+		}
+		if n, err := strconv.Atoi(spec); err == nil && n >= 0 {
+			return refs.ReadAt(ref, n)
+		}
+		date, err := gitdate.Parse(spec, time.Now())
+		if err != nil {
+			return "", err
+		}
+		return refs.ReadAtTime(ref, date)
+	}
+
+	if fullHash.MatchString(name) {
+		return name, nil
+	}
+	if ref, err := refs.Dwim(name); err == nil {
+		return refs.Read(ref)
+	}
+	if shortHash.MatchString(name) {
+		if hash, err := gitobject.FullHash(name); err == nil {
+			return hash, nil
+		}
+	}
+	return "", fmt.Errorf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.", name)
+}
+
+// branchForAt works out the ref a name@{...} lookup applies to. A missing
+// name means the current branch, or HEAD itself when detached.
+func branchForAt(name string) (ref string, err error) {
+	if name != "" {
+		return refs.Dwim(name)
+	}
+	if target, err := refs.ReadSymbolic("HEAD"); err == nil {
+		return target, nil
+	}
+	return "HEAD", nil
+}
+
+// SymbolicFullName returns the full ref name an expression like main, HEAD
+// or @{upstream} refers to. Expressions that don't name a ref give "".
+func SymbolicFullName(expr string) (fullName string, err error) {
+	if expr == "@" {
+		expr = "HEAD"
+	}
+	if at := strings.Index(expr, "@{"); at >= 0 && strings.HasSuffix(expr, "}") {
+		switch strings.ToLower(expr[at+2 : len(expr)-1]) {
+		case "u", "upstream":
+			ref, err := branchForAt(expr[:at])
+			if err != nil {
+				return "", err
+			}
+			if ref == "HEAD" {
+				if ref, err = refs.ReadSymbolic("HEAD"); err != nil {
+					return "", fmt.Errorf("fatal: HEAD does not point to a branch")
+				}
+			}
+			return Upstream(strings.TrimPrefix(ref, "refs/heads/"))
+		}
+		return "", nil
+	}
+	ref, err := refs.Dwim(expr)
+	if err != nil {
+		return "", nil
+	}
+	fullName, _, err = refs.Resolve(ref)
+	return fullName, err
+}
+
+// Upstream returns the full name of the ref branch is configured to track.
+func Upstream(branch string) (upstream string, err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	remoteName, hasRemote := cfg.Get(fmt.Sprintf("branch.%s.remote", branch))
+	merge, hasMerge := cfg.Get(fmt.Sprintf("branch.%s.merge", branch))
+	if !hasRemote || !hasMerge {
+		return "", fmt.Errorf("no upstream configured for branch '%s'", branch)
+	}
+	if remoteName == "." {
+		return merge, nil
+	}
+	return fmt.Sprintf("refs/remotes/%s/%s", remoteName, strings.TrimPrefix(merge, "refs/heads/")), nil
+}
+
+func ancestor(hash string, generations int, expr string) (result string, err error) {
+	for i := 0; i < generations; i++ {
+		if hash, err = parent(hash, 1, expr); err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+func parent(hash string, n int, expr string) (result string, err error) {
+	if n == 0 {
+		return hash, nil
+	}
+	commit, err := gitobject.ReadCommit(hash)
+	if err != nil {
+		return "", err
+	}
+	if n > len(commit.Parents) {
+		return "", fmt.Errorf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.", expr)
+	}
+	return commit.Parents[n-1], nil
+}
+
+func resolveTreePath(treeish string, path string) (hash string, err error) {
+	tree, err := PeelTo(treeish, "tree")
+	if err != nil {
+		return "", err
+	}
+	node, found, err := gitobject.LookupPath(tree, path)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("fatal: path '%s' does not exist in '%s'", path, treeish)
+	}
+	return node.Hash, nil
+}
+
+func resolveIndexPath(path string) (hash string, err error) {
+	stage := 0
+	if match := indexPath.FindStringSubmatch(path); match != nil {
+		stage, _ = strconv.Atoi(match[1])
+		path = match[2]
+	}
+	idx, err := index.Read()
+	if err != nil {
+		return "", err
+	}
+	entry, ok := idx.Find(path, stage)
+	if !ok {
+		return "", fmt.Errorf("fatal: path '%s' does not exist (neither on disk nor in the index)", path)
+	}
+	return entry.Hash, nil
+}
+
+// topLevelIndex finds the first of chars outside an @{...} block, where
+// reflog dates may contain colons and other punctuation.
+func topLevelIndex(expr string, chars string) int {
+	depth := 0
+	for i, c := range expr {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case depth == 0 && strings.ContainsRune(chars, c):
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,261 @@
+package revwalk
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/refs"
+)
+
+// paint flags for finding merge bases
+const (
+	fromOne = 1 << iota
+	fromTwo
+	// stale commits are below a common ancestor already found, so can't be
+	// a better one
+	stale
+	common
+)
+
+// MergeBases returns the best common ancestors of the commits in ones and
+// those in twos: the commits reachable from both sides that aren't
+// ancestors of another such commit. They come newest first.
+func MergeBases(ones []string, twos []string) (bases []string, err error) {
+	for _, one := range ones {
+		for _, two := range twos {
+			if one == two {
+				return []string{one}, nil
+			}
+		}
+	}
+
+	candidates, err := paintDownToCommon(ones, twos)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > 1 {
+		if candidates, err = removeRedundant(candidates); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].commit.Committer.When.After(candidates[j].commit.Committer.When)
+	})
+	for _, candidate := range candidates {
+		bases = append(bases, candidate.hash)
+	}
+	return bases, nil
+}
+
+// paintDownToCommon walks down from both sides by date, painting each
+// commit with the sides that reach it. Commits painted by both are common
+// ancestors, and everything below them is marked stale so the walk can
+// stop once only stale commits are left.
+func paintDownToCommon(ones []string, twos []string) (candidates []*entry, err error) {
+	entries := map[string]*entry{}
+	queue := commitQueue{}
+	load := func(hash string) (*entry, error) {
+		if e, found := entries[hash]; found {
+			return e, nil
+		}
+		commit, err := gitobject.ReadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		e := &entry{hash: hash, commit: commit, order: len(entries)}
+		entries[hash] = e
+		return e, nil
+	}
+	for side, hashes := range [][]string{ones, twos} {
+		for _, hash := range hashes {
+			e, err := load(hash)
+			if err != nil {
+				return nil, err
+			}
+			e.flags |= fromOne << side
+			heap.Push(&queue, e)
+		}
+	}
+
+	found := []*entry{}
+	for hasNonStale(queue) {
+		e := heap.Pop(&queue).(*entry)
+		flags := e.flags & (fromOne | fromTwo | stale)
+		if flags == fromOne|fromTwo {
+			if e.flags&common == 0 {
+				e.flags |= common
+				found = append(found, e)
+			}
+			flags |= stale
+		}
+		for _, parent := range e.commit.Parents {
+			p, err := load(parent)
+			if err != nil {
+				return nil, err
+			}
+			if p.flags&flags == flags {
+				continue
+			}
+			p.flags |= flags
+			heap.Push(&queue, p)
+		}
+	}
+
+	// a common ancestor found early may turn out to be below a later one
+	for _, e := range found {
+		if e.flags&stale == 0 {
+			candidates = append(candidates, e)
+		}
+	}
+	return candidates, nil
+}
+
+func hasNonStale(queue commitQueue) bool {
+	for _, e := range queue {
+		if e.flags&stale == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// removeRedundant drops the candidates that another candidate can reach.
+func removeRedundant(candidates []*entry) (kept []*entry, err error) {
+	for i, candidate := range candidates {
+		others := []string{}
+		for j, other := range candidates {
+			if i != j {
+				others = append(others, other.hash)
+			}
+		}
+		redundant, err := reachable(candidate.hash, others)
+		if err != nil {
+			return nil, err
+		}
+		if !redundant {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept, nil
+}
+
+// reachable reports whether target is an ancestor of any of starts, or one
+// of them. Nothing can be painted from both sides above target, so it is a
+// common ancestor exactly when the starts reach it, and the walk stops as
+// soon as the commits left are below it.
+func reachable(target string, starts []string) (found bool, err error) {
+	candidates, err := paintDownToCommon([]string{target}, starts)
+	if err != nil {
+		return false, err
+	}
+	for _, candidate := range candidates {
+		if candidate.hash == target {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsAncestor reports whether ancestor can be reached from descendant. A
+// commit is its own ancestor.
+func IsAncestor(ancestor string, descendant string) (found bool, err error) {
+	if ancestor == descendant {
+		return true, nil
+	}
+	return reachable(ancestor, []string{descendant})
+}
+
+// OctopusMergeBases returns the best common ancestors of all of commits at
+// once, as an octopus merge of them would use, newest first.
+func OctopusMergeBases(commits []string) (bases []string, err error) {
+	for i, commit := range commits {
+		if i == 0 {
+			bases = []string{commit}
+			continue
+		}
+		next := []string{}
+		for _, base := range bases {
+			found, err := MergeBases([]string{commit}, []string{base})
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, found...)
+		}
+		bases = next
+	}
+	return Independent(bases)
+}
+
+// Independent drops the commits that another of commits can reach, and
+// repeats, keeping the order of the rest.
+func Independent(commits []string) (kept []string, err error) {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, commit := range commits {
+		if !seen[commit] {
+			seen[commit] = true
+			unique = append(unique, commit)
+		}
+	}
+	for i, commit := range unique {
+		others := []string{}
+		for j, other := range unique {
+			if i != j {
+				others = append(others, other)
+			}
+		}
+		redundant, err := reachable(commit, others)
+		if err != nil {
+			return nil, err
+		}
+		if !redundant {
+			kept = append(kept, commit)
+		}
+	}
+	return kept, nil
+}
+
+// ForkPoint finds where commit forked from the ref named refName, looking
+// through every commit the ref's reflog says it pointed at, so a branch
+// built on a since-rewritten upstream still finds its base. It returns ""
+// when there is no single merge base among those commits.
+func ForkPoint(refName string, commit string) (forkPoint string, err error) {
+	entries, err := refs.ReadReflog(refName)
+	if err != nil {
+		return "", err
+	}
+	tips := []string{}
+	seen := map[string]bool{}
+	add := func(hash string) {
+		if hash == refs.ZeroHash || seen[hash] {
+			return
+		}
+		seen[hash] = true
+		if objectType, _, err := gitobject.ReadObject(hash); err == nil && objectType == "commit" {
+			tips = append(tips, hash)
+		}
+	}
+	for i, entry := range entries {
+		if i == 0 {
+			add(entry.OldHash)
+		}
+		add(entry.NewHash)
+	}
+	if len(tips) == 0 {
+		hash, err := refs.Read(refName)
+		if err != nil {
+			return "", err
+		}
+		add(hash)
+	}
+
+	bases, err := MergeBases([]string{commit}, tips)
+	if err != nil {
+		return "", err
+	}
+	if len(bases) != 1 || !seen[bases[0]] {
+		return "", nil
+	}
+	return bases[0], nil
+}
@@ -0,0 +1,529 @@
+package revwalk
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/gitobject"
+)
+
+const (
+	uninteresting = 1 << iota
+	// treesame commits don't touch the walked paths and are left out
+	treesame
+)
+
+type entry struct {
+	hash   string
+	commit *gitobject.Commit
+	flags  int
+	// parents are the ones the walk followed
+	parents []string
+	// order breaks ties between commits with the same date, first come first
+	// served
+	order int
+}
+
+// Walker yields the commits reachable from the pushed commits but not from the
+// hidden ones, newest first by committer date.
+type Walker struct {
+	// FirstParent follows only the first parent of merges.
+	FirstParent bool
+	// TopoOrder never shows a commit before all of its children, and keeps
+	// the commits of a side branch together.
+	TopoOrder bool
+	// Paths limits the walk to commits that change one of these paths.
+	// Merges that match one parent at those paths are simplified away by
+	// only following that parent.
+	Paths []string
+
+	entries map[string]*entry
+	queue   commitQueue
+	counter int
+	hidden  bool
+	// results holds the whole output once a limited walk has run
+	results []*entry
+	limited bool
+}
+
+func New() *Walker {
+	return &Walker{entries: map[string]*entry{}}
+}
+
+// Push adds a commit whose history should be walked.
+func (w *Walker) Push(hash string) error {
+	_, err := w.add(hash, 0)
+	return err
+}
+
+// Hide excludes a commit and everything reachable from it.
+func (w *Walker) Hide(hash string) error {
+	w.hidden = true
+	_, err := w.add(hash, uninteresting)
+	return err
+}
+
+// Next returns the next commit of the walk, or io.EOF once it is done.
+func (w *Walker) Next() (hash string, commit *gitobject.Commit, err error) {
+	if w.hidden || w.TopoOrder || len(w.Paths) > 0 {
+		if !w.limited {
+			if err := w.limit(); err != nil {
+				return "", nil, err
+			}
+		}
+		if len(w.results) == 0 {
+			return "", nil, io.EOF
+		}
+		next := w.results[0]
+		w.results = w.results[1:]
+		return next.hash, next.commit, nil
+	}
+
+	for w.queue.Len() > 0 {
+		e := heap.Pop(&w.queue).(*entry)
+		if err := w.process(e); err != nil {
+			return "", nil, err
+		}
+		if e.flags&(uninteresting|treesame) == 0 {
+			return e.hash, e.commit, nil
+		}
+	}
+	return "", nil, io.EOF
+}
+
+// limit walks everything up front, which is needed to know for sure that a
+// commit isn't reachable from a hidden one, and to sort topologically.
+func (w *Walker) limit() error {
+	w.limited = true
+	walked := []*entry{}
+	for w.queue.Len() > 0 && !w.everybodyUninteresting() {
+		e := heap.Pop(&w.queue).(*entry)
+		if err := w.process(e); err != nil {
+			return err
+		}
+		walked = append(walked, e)
+	}
+
+	for _, e := range walked {
+		// a commit may have been found to be hidden after it was walked
+		if e.flags&(uninteresting|treesame) == 0 {
+			w.results = append(w.results, e)
+		}
+	}
+	if w.TopoOrder {
+		w.results = w.sortTopologically(w.results)
+	}
+	return nil
+}
+
+func (w *Walker) everybodyUninteresting() bool {
+	for _, e := range w.queue {
+		if e.flags&uninteresting == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// process queues a popped commit's parents.
+func (w *Walker) process(e *entry) error {
+	parents := w.parentsOf(e)
+	e.parents = parents
+	if e.flags&uninteresting != 0 {
+		for _, parent := range parents {
+			p, err := w.add(parent, uninteresting)
+			if err != nil {
+				return err
+			}
+			w.markUninteresting(p)
+		}
+		return nil
+	}
+
+	if len(w.Paths) > 0 {
+		var err error
+		if parents, err = w.simplify(e, parents); err != nil {
+			return err
+		}
+		e.parents = parents
+	}
+	for _, parent := range parents {
+		if _, err := w.add(parent, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Walker) parentsOf(e *entry) []string {
+	if w.FirstParent && len(e.commit.Parents) > 1 {
+		return e.commit.Parents[:1]
+	}
+	return e.commit.Parents
+}
+
+// simplify marks a commit that leaves the walked paths as they were in one of
+// its parents, and then only follows that parent.
+func (w *Walker) simplify(e *entry, parents []string) (followed []string, err error) {
+	if len(parents) == 0 {
+		same, err := w.sameAtPaths(e.commit.Tree, "")
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			e.flags |= treesame
+		}
+		return parents, nil
+	}
+
+	for _, parent := range parents {
+		parentCommit, err := gitobject.ReadCommit(parent)
+		if err != nil {
+			return nil, err
+		}
+		same, err := w.sameAtPaths(e.commit.Tree, parentCommit.Tree)
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			e.flags |= treesame
+			return []string{parent}, nil
+		}
+	}
+	return parents, nil
+}
+
+// sameAtPaths compares two trees at the walked paths. An empty tree hash
+// stands for a commit without parents, where nothing existed before.
+func (w *Walker) sameAtPaths(treeA string, treeB string) (same bool, err error) {
+	for _, path := range w.Paths {
+		nodeA, foundA, err := gitobject.LookupPath(treeA, path)
+		if err != nil {
+			return false, err
+		}
+		nodeB, foundB := gitobject.TreeNode{}, false
+		if treeB != "" {
+			if nodeB, foundB, err = gitobject.LookupPath(treeB, path); err != nil {
+				return false, err
+			}
+		}
+		if foundA != foundB || nodeA.Hash != nodeB.Hash || nodeA.Mode != nodeB.Mode {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// add loads a commit the first time it is seen and queues it.
+func (w *Walker) add(hash string, flags int) (e *entry, err error) {
+	if e, ok := w.entries[hash]; ok {
+		e.flags |= flags
+		return e, nil
+	}
+	commit, err := gitobject.ReadCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	e = &entry{hash: hash, commit: commit, flags: flags, order: w.counter}
+	w.counter++
+	w.entries[hash] = e
+	heap.Push(&w.queue, e)
+	return e, nil
+}
+
+// markUninteresting spreads the flag to ancestors that were already walked,
+// since they won't be processed again.
+func (w *Walker) markUninteresting(e *entry) {
+	stack := []*entry{e}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, parent := range w.parentsOf(e) {
+			if p, ok := w.entries[parent]; ok && p.flags&uninteresting == 0 {
+				p.flags |= uninteresting
+				stack = append(stack, p)
+			}
+		}
+	}
+}
+
+// Parents returns the parents of a commit the walk returned as its output
+// should show them, skipping over commits that were simplified away.
+func (w *Walker) Parents(hash string) (parents []string) {
+	seen := map[string]bool{}
+	for _, parent := range w.entries[hash].parents {
+		for {
+			p, ok := w.entries[parent]
+			if !ok || p.flags&uninteresting != 0 {
+				break
+			}
+			if p.flags&treesame == 0 {
+				if !seen[parent] {
+					seen[parent] = true
+					parents = append(parents, parent)
+				}
+				break
+			}
+			if len(p.parents) == 0 {
+				break
+			}
+			parent = p.parents[0]
+		}
+	}
+	return parents
+}
+
+// sortTopologically emits commits once all of their children have been,
+// following the most recently reached parent first like git's --topo-order.
+func (w *Walker) sortTopologically(commits []*entry) []*entry {
+	inList := map[string]bool{}
+	for _, e := range commits {
+		inList[e.hash] = true
+	}
+	children := map[string]int{}
+	for _, e := range commits {
+		for _, parent := range w.Parents(e.hash) {
+			if inList[parent] {
+				children[parent]++
+			}
+		}
+	}
+
+	stack := []*entry{}
+	for i := len(commits) - 1; i >= 0; i-- {
+		if children[commits[i].hash] == 0 {
+			stack = append(stack, commits[i])
+		}
+	}
+	sorted := make([]*entry, 0, len(commits))
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		sorted = append(sorted, e)
+		for _, parent := range w.Parents(e.hash) {
+			if !inList[parent] {
+				continue
+			}
+			children[parent]--
+			if children[parent] == 0 {
+				stack = append(stack, w.entries[parent])
+			}
+		}
+	}
+	return sorted
+}
+
+// Object is a tree or blob reached while walking the trees of commits.
+type Object struct {
+	Hash string
+	Type string
+	// Path is where the object was first found, "" for a root tree.
+	Path string
+	// Missing objects aren't in the object store.
+	Missing bool
+	// Omitted objects were left out by the filter.
+	Omitted bool
+}
+
+// Filter leaves objects out of an object walk, like rev-list's --filter.
+type Filter struct {
+	// BlobLimit omits blobs of at least this many bytes. Negative keeps all
+	// blobs and zero omits them all.
+	BlobLimit int
+	// TreeDepth omits trees and blobs this many levels or more below the
+	// root tree, which is at depth zero. Negative keeps everything.
+	TreeDepth int
+}
+
+var NoFilter = Filter{BlobLimit: -1, TreeDepth: -1}
+
+// ParseFilter understands the blob:none, blob:limit=<n>[kmg] and
+// tree:<depth> filter specs.
+func ParseFilter(spec string) (filter Filter, err error) {
+	filter = NoFilter
+	switch {
+	case spec == "blob:none":
+		filter.BlobLimit = 0
+	case strings.HasPrefix(spec, "blob:limit="):
+		limit := strings.TrimPrefix(spec, "blob:limit=")
+		if limit == "" {
+			return Filter{}, fmt.Errorf("invalid filter-spec '%s'", spec)
+		}
+		multiplier := 1
+		switch strings.ToLower(limit[len(limit)-1:]) {
+		case "k":
+			multiplier = 1 << 10
+		case "m":
+			multiplier = 1 << 20
+		case "g":
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			limit = limit[:len(limit)-1]
+		}
+		size, err := strconv.Atoi(limit)
+		if err != nil || size < 0 {
+			return Filter{}, fmt.Errorf("invalid filter-spec '%s'", spec)
+		}
+		filter.BlobLimit = size * multiplier
+	case strings.HasPrefix(spec, "tree:"):
+		depth, err := strconv.Atoi(strings.TrimPrefix(spec, "tree:"))
+		if err != nil || depth < 0 {
+			return Filter{}, fmt.Errorf("invalid filter-spec '%s'", spec)
+		}
+		filter.TreeDepth = depth
+	default:
+		return Filter{}, fmt.Errorf("invalid filter-spec '%s'", spec)
+	}
+	return filter, nil
+}
+
+// Objects visits the trees and blobs reachable from the trees of commits,
+// each once and depth first in tree order like rev-list --objects. Objects
+// reachable from hidden commits the walk came across are left out.
+func (w *Walker) Objects(commits []string, filter Filter, visit func(Object) error) (err error) {
+	seen := map[string]bool{}
+	for _, e := range w.entries {
+		if e.flags&uninteresting != 0 {
+			if err := markTreeSeen(e.commit.Tree, seen); err != nil {
+				return err
+			}
+		}
+	}
+	for _, hash := range commits {
+		commit, err := gitobject.ReadCommit(hash)
+		if err != nil {
+			return err
+		}
+		if err := walkTree(commit.Tree, "", 0, filter, seen, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTree(hash string, path string, depth int, filter Filter, seen map[string]bool, visit func(Object) error) (err error) {
+	if seen[hash] {
+		return nil
+	}
+	seen[hash] = true
+	object := Object{Hash: hash, Type: "tree", Path: path, Omitted: filter.TreeDepth >= 0 && depth >= filter.TreeDepth}
+	if !gitobject.Exists(hash) {
+		// a tree left out by the filter is allowed to be missing
+		object.Missing = !object.Omitted
+		return visit(object)
+	}
+	if err := visit(object); err != nil {
+		return err
+	}
+
+	nodes, err := readTree(hash)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		childPath := node.Name
+		if path != "" {
+			childPath = path + "/" + node.Name
+		}
+		switch node.Mode {
+		case 40000:
+			err = walkTree(node.Hash, childPath, depth+1, filter, seen, visit)
+		case 160000:
+			// submodule commits live in another repository
+		default:
+			err = visitBlob(node.Hash, childPath, depth+1, filter, seen, visit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func visitBlob(hash string, path string, depth int, filter Filter, seen map[string]bool, visit func(Object) error) (err error) {
+	if seen[hash] {
+		return nil
+	}
+	seen[hash] = true
+	object := Object{Hash: hash, Type: "blob", Path: path}
+	switch {
+	case filter.TreeDepth >= 0 && depth >= filter.TreeDepth:
+		object.Omitted = true
+	case filter.BlobLimit == 0:
+		object.Omitted = true
+	case !gitobject.Exists(hash):
+		object.Missing = true
+	case filter.BlobLimit > 0:
+		size, err := gitobject.Size(hash)
+		if err != nil {
+			return err
+		}
+		object.Omitted = size >= filter.BlobLimit
+	}
+	return visit(object)
+}
+
+// markTreeSeen marks everything in a tree as already visited. Parts of it
+// that are missing are of no interest either.
+func markTreeSeen(hash string, seen map[string]bool) (err error) {
+	if seen[hash] || !gitobject.Exists(hash) {
+		return nil
+	}
+	seen[hash] = true
+	nodes, err := readTree(hash)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		switch node.Mode {
+		case 40000:
+			err = markTreeSeen(node.Hash, seen)
+		case 160000:
+		default:
+			seen[node.Hash] = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTree(hash string) (nodes []gitobject.TreeNode, err error) {
+	objectType, data, err := gitobject.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != "tree" {
+		return nil, fmt.Errorf("%s is not a tree", hash)
+	}
+	return gitobject.ReadTree(len(data), bytes.NewReader(data)), nil
+}
+
+// commitQueue is a max-heap on committer date.
+type commitQueue []*entry
+
+func (q commitQueue) Len() int { return len(q) }
+
+func (q commitQueue) Less(i, j int) bool {
+	if !q[i].commit.Committer.When.Equal(q[j].commit.Committer.When) {
+		return q[i].commit.Committer.When.After(q[j].commit.Committer.When)
+	}
+	return q[i].order < q[j].order
+}
+
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x any) { *q = append(*q, x.(*entry)) }
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,39 @@
+package revwalk
+
+import "testing"
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Filter
+		err  bool
+	}{
+		{spec: "blob:none", want: Filter{BlobLimit: 0, TreeDepth: -1}},
+		{spec: "blob:limit=0", want: Filter{BlobLimit: 0, TreeDepth: -1}},
+		{spec: "blob:limit=100", want: Filter{BlobLimit: 100, TreeDepth: -1}},
+		{spec: "blob:limit=2k", want: Filter{BlobLimit: 2048, TreeDepth: -1}},
+		{spec: "blob:limit=1M", want: Filter{BlobLimit: 1 << 20, TreeDepth: -1}},
+		{spec: "tree:0", want: Filter{BlobLimit: -1, TreeDepth: 0}},
+		{spec: "tree:3", want: Filter{BlobLimit: -1, TreeDepth: 3}},
+		{spec: "blob:limit=", err: true},
+		{spec: "blob:limit=k", err: true},
+		{spec: "blob:limit=-1", err: true},
+		{spec: "tree:", err: true},
+		{spec: "tree:-1", err: true},
+		{spec: "sparse:oid=abc", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			got, err := ParseFilter(test.spec)
+			if test.err {
+				if err == nil || err.Error() != "invalid filter-spec '"+test.spec+"'" {
+					t.Errorf("ParseFilter() = %v, %v, want an invalid filter-spec error", got, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("ParseFilter() = %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package submodule
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/cmd/mygit/config"
+)
+
+// modulesFile lists the submodules at the top of the working tree.
+const modulesFile = ".gitmodules"
+
+// Submodule is one entry of .gitmodules: a repository checked out at Path,
+// whose commit the superproject records as a gitlink.
+type Submodule struct {
+	Name   string
+	Path   string
+	URL    string
+	Branch string
+}
+
+// Read returns the submodules in .gitmodules in the order they appear.
+// Entries without a path are skipped, like git does, and a missing file
+// has none.
+func Read() (submodules []Submodule, err error) {
+	cfg, err := config.LoadFile(modulesFile)
+	if err != nil {
+		return nil, err
+	}
+	submodules = []Submodule{}
+	for _, name := range cfg.Subsections("submodule") {
+		path, ok := cfg.Get("submodule." + name + ".path")
+		if !ok || path == "" {
+			continue
+		}
+		url, _ := cfg.Get("submodule." + name + ".url")
+		branch, _ := cfg.Get("submodule." + name + ".branch")
+		submodules = append(submodules, Submodule{Name: name, Path: strings.TrimSuffix(path, "/"), URL: url, Branch: branch})
+	}
+	return submodules, nil
+}
+
+// ResolveURL makes a URL starting with ./ or ../ relative to base, the
+// superproject's remote: ./ goes below it and each ../ drops one component.
+// Other URLs are returned as they are.
+func ResolveURL(url string, base string) string {
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url
+	}
+	base = strings.TrimSuffix(base, "/")
+	for {
+		if rest, found := strings.CutPrefix(url, "./"); found {
+			url = rest
+		} else if rest, found := strings.CutPrefix(url, "../"); found {
+			url = rest
+			if slash := strings.LastIndex(base, "/"); slash >= 0 {
+				base = base[:slash]
+			}
+		} else {
+			break
+		}
+	}
+	return base + "/" + url
+}